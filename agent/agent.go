@@ -0,0 +1,72 @@
+// Package agent serves secrets from a sneaker.Manager to other processes on
+// the same host over a Unix socket.
+//
+// Processes which each download their secrets at startup each call KMS to
+// decrypt them, which is slow and, with enough processes, throttled. A Server
+// holds a single Manager and a cache of decrypted secrets, and authorizes
+// each request by the user and group of the process which made it. A Client
+// talks to a Server, and has the same Download and List methods as a Manager,
+// so code written against Source can use either.
+//
+// The protocol is newline-delimited JSON: a client writes a Request and the
+// server writes a Response, any number of times over a connection.
+package agent
+
+import (
+	"context"
+
+	"github.com/codahale/sneaker"
+)
+
+// A Source is somewhere secrets can be listed and downloaded from: a
+// *sneaker.Manager or a *Client.
+type Source interface {
+	DownloadContext(ctx context.Context, paths []string) (map[string][]byte, error)
+	ListContext(ctx context.Context, pattern string) ([]sneaker.File, error)
+}
+
+var (
+	_ Source = &sneaker.Manager{}
+	_ Source = &Client{}
+)
+
+// The operations a Request can ask for.
+const (
+	OpGet  = "get"
+	OpList = "list"
+)
+
+// A Request asks the agent for a secret or a list of secrets.
+type Request struct {
+	// Op is OpGet or OpList.
+	Op string `json:"op"`
+
+	// Path is the path of the secret to get.
+	Path string `json:"path,omitempty"`
+
+	// Pattern is the pattern of secrets to list, in the form used by
+	// sneaker.Manager.List.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// A Response is the agent's answer to a Request.
+type Response struct {
+	// Value is the plaintext of the requested secret.
+	Value []byte `json:"value,omitempty"`
+
+	// Files are the listed secrets which the client is allowed to get.
+	Files []sneaker.File `json:"files,omitempty"`
+
+	// Error is the error message, if the request failed.
+	Error string `json:"error,omitempty"`
+
+	// Code is the kind of error: CodeNotFound, CodeAccessDenied, or blank.
+	Code string `json:"code,omitempty"`
+}
+
+// The error codes in a Response. Client returns them as awserr.Errors, so
+// sneaker.IsNotFound works as it does with a Manager.
+const (
+	CodeNotFound     = "NotFound"
+	CodeAccessDenied = "AccessDenied"
+)
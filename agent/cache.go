@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/codahale/sneaker"
+)
+
+// A cache holds decrypted secrets and listings from a Manager.
+//
+// Secrets are served from the cache for the TTL after they were last checked.
+// After that, their ETags are checked with a HEAD request, and they're only
+// downloaded and decrypted again if they've changed. Listings are cached for
+// the TTL, and only the most recent maxListings patterns are kept.
+type cache struct {
+	manager *sneaker.Manager
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	secrets  map[string]*cachedSecret
+	listings map[string]*cachedListing
+}
+
+type cachedSecret struct {
+	mu      sync.Mutex // held while the secret is fetched or checked
+	value   []byte
+	etag    string
+	checked time.Time
+}
+
+// maxListings is the most listings a cache holds.
+const maxListings = 64
+
+type cachedListing struct {
+	files   []sneaker.File
+	fetched time.Time
+}
+
+func newCache(manager *sneaker.Manager, ttl time.Duration) *cache {
+	return &cache{
+		manager:  manager,
+		ttl:      ttl,
+		now:      time.Now,
+		secrets:  map[string]*cachedSecret{},
+		listings: map[string]*cachedListing{},
+	}
+}
+
+// get returns the plaintext of the given secret. Concurrent gets of the same
+// secret share a single download.
+func (c *cache) get(ctx context.Context, path string) ([]byte, error) {
+	c.mu.Lock()
+	s, ok := c.secrets[path]
+	if !ok {
+		s = &cachedSecret{}
+		c.secrets[path] = s
+	}
+	c.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := c.now()
+	if s.etag != "" {
+		if now.Sub(s.checked) < c.ttl {
+			return s.value, nil
+		}
+
+		etag, err := c.manager.ETagContext(ctx, path)
+		if err != nil {
+			c.forget(path, s)
+			return nil, err
+		}
+
+		if etag == s.etag {
+			s.checked = now
+			return s.value, nil
+		}
+	}
+
+	value, etag, err := c.manager.DownloadWithETagContext(ctx, path)
+	if err != nil {
+		c.forget(path, s)
+		return nil, err
+	}
+
+	s.value, s.etag, s.checked = value, etag, now
+	return value, nil
+}
+
+// forget removes the given secret from the cache, unless it's already been
+// replaced.
+func (c *cache) forget(path string, s *cachedSecret) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.secrets[path] == s {
+		delete(c.secrets, path)
+	}
+	s.value, s.etag = nil, ""
+}
+
+// list returns the secrets matching the given pattern.
+func (c *cache) list(ctx context.Context, pattern string) ([]sneaker.File, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	l, ok := c.listings[pattern]
+	c.mu.Unlock()
+
+	if ok && now.Sub(l.fetched) < c.ttl {
+		return l.files, nil
+	}
+
+	files, err := c.manager.ListContext(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictListings(now)
+	c.listings[pattern] = &cachedListing{files: files, fetched: now}
+	return files, nil
+}
+
+// evictListings makes room for another listing by removing the expired ones,
+// or if there are none, the oldest. c.mu must be held.
+func (c *cache) evictListings(now time.Time) {
+	if len(c.listings) < maxListings {
+		return
+	}
+
+	var (
+		oldest  string
+		fetched time.Time
+	)
+	for p, l := range c.listings {
+		if now.Sub(l.fetched) >= c.ttl {
+			delete(c.listings, p)
+		} else if fetched.IsZero() || l.fetched.Before(fetched) {
+			oldest, fetched = p, l.fetched
+		}
+	}
+
+	if len(c.listings) >= maxListings {
+		delete(c.listings, oldest)
+	}
+}
@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/codahale/sneaker"
+)
+
+func TestCache(t *testing.T) {
+	man, keys, cleanup := testManager(t)
+	defer cleanup()
+
+	if err := man.Upload("db/password", strings.NewReader("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	c := newCache(man, time.Minute)
+	c.now = func() time.Time { return now }
+
+	get := func(want string, decrypts int32) {
+		v, err := c.get(context.Background(), "db/password")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(v) != want {
+			t.Errorf("Value was %q, but expected %q", v, want)
+		}
+
+		if n := atomic.LoadInt32(&keys.decrypts); n != decrypts {
+			t.Errorf("Decrypted %d times, but expected %d", n, decrypts)
+		}
+	}
+
+	get("hunter2", 1)
+
+	// served from the cache
+	now = now.Add(30 * time.Second)
+	get("hunter2", 1)
+
+	// revalidated, but unchanged
+	now = now.Add(time.Minute)
+	get("hunter2", 1)
+
+	if err := man.Upload("db/password", strings.NewReader("hunter3")); err != nil {
+		t.Fatal(err)
+	}
+
+	// still fresh
+	get("hunter2", 1)
+
+	// revalidated and changed
+	now = now.Add(time.Minute)
+	get("hunter3", 2)
+
+	if err := man.Rm("db/password"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.get(context.Background(), "db/password"); !sneaker.IsNotFound(err) {
+		t.Errorf("Error was %v, but expected it to be not found", err)
+	}
+
+	if v := len(c.secrets); v != 0 {
+		t.Errorf("Cached %d secrets, but expected none", v)
+	}
+}
+
+func TestCacheList(t *testing.T) {
+	man, _, cleanup := testManager(t)
+	defer cleanup()
+
+	if err := man.Upload("a", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1000, 0)
+	c := newCache(man, time.Minute)
+	c.now = func() time.Time { return now }
+
+	list := func(want int) {
+		files, err := c.list(context.Background(), "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v := len(files); v != want {
+			t.Errorf("Listed %d secrets, but expected %d", v, want)
+		}
+	}
+
+	list(1)
+
+	if err := man.Upload("b", strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	list(1)
+
+	now = now.Add(time.Minute)
+	list(2)
+}
+
+func TestCacheListEviction(t *testing.T) {
+	man, _, cleanup := testManager(t)
+	defer cleanup()
+
+	now := time.Unix(1000, 0)
+	c := newCache(man, time.Hour)
+	c.now = func() time.Time { return now }
+
+	list := func(pattern string, want int) {
+		if _, err := c.list(context.Background(), pattern); err != nil {
+			t.Fatal(err)
+		}
+
+		if v := len(c.listings); v != want {
+			t.Errorf("Cached %d listings, but expected %d", v, want)
+		}
+	}
+
+	for i := 0; i < maxListings; i++ {
+		list(fmt.Sprintf("pattern%d", i), i+1)
+		now = now.Add(time.Second)
+	}
+
+	// the oldest listing is evicted
+	list("newest", maxListings)
+	if _, ok := c.listings["pattern0"]; ok {
+		t.Error("Didn't evict the oldest listing")
+	}
+
+	// expired listings are all evicted
+	now = now.Add(2 * time.Hour)
+	list("last", 1)
+}
+
+// countingKeyring counts the data keys it decrypts.
+type countingKeyring struct {
+	*sneaker.Keyring
+	decrypts int32
+}
+
+func (k *countingKeyring) Decrypt(req *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	atomic.AddInt32(&k.decrypts, 1)
+	return k.Keyring.Decrypt(req)
+}
+
+func testManager(t *testing.T) (*sneaker.Manager, *countingKeyring, func()) {
+	root, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := new(sneaker.Keyring)
+	if err := keyring.AddKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	keys := &countingKeyring{Keyring: keyring}
+
+	return &sneaker.Manager{
+		Objects: &sneaker.FileStorage{Root: root},
+		Envelope: sneaker.Envelope{
+			KMS: keys,
+		},
+		KeyId:  "key1",
+		Bucket: "bucket",
+	}, keys, func() { _ = os.RemoveAll(root) }
+}
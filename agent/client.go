@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/codahale/sneaker"
+)
+
+// A Client gets secrets from an agent.
+type Client struct {
+	// Socket is the path of the agent's Unix socket.
+	Socket string
+}
+
+// Download gets the given secrets from the agent. If any secrets can't be
+// downloaded, the error is a sneaker.PathErrors.
+func (c *Client) Download(paths []string) (map[string][]byte, error) {
+	return c.DownloadContext(context.Background(), paths)
+}
+
+// DownloadContext is like Download, but stops if ctx is done.
+func (c *Client) DownloadContext(ctx context.Context, paths []string) (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(paths))
+	errs := sneaker.PathErrors{}
+	if err := c.do(ctx, func(do func(*Request) (*Response, error)) error {
+		for _, path := range paths {
+			resp, err := do(&Request{Op: OpGet, Path: path})
+			if err != nil {
+				return err
+			}
+
+			if err := resp.err(); err != nil {
+				errs[path] = err
+				continue
+			}
+			secrets[path] = resp.Value
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return secrets, nil
+}
+
+// List returns the secrets matching the given pattern which the client is
+// allowed to get.
+func (c *Client) List(pattern string) ([]sneaker.File, error) {
+	return c.ListContext(context.Background(), pattern)
+}
+
+// ListContext is like List, but stops if ctx is done.
+func (c *Client) ListContext(ctx context.Context, pattern string) ([]sneaker.File, error) {
+	var files []sneaker.File
+	err := c.do(ctx, func(do func(*Request) (*Response, error)) error {
+		resp, err := do(&Request{Op: OpList, Pattern: pattern})
+		if err != nil {
+			return err
+		}
+
+		if err := resp.err(); err != nil {
+			return err
+		}
+		files = resp.Files
+		return nil
+	})
+	return files, err
+}
+
+// do connects to the agent and calls f with a function which sends a request
+// and returns the response.
+func (c *Client) do(ctx context.Context, f func(func(*Request) (*Response, error)) error) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.Socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// unblock reads and writes if ctx is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	enc, dec := json.NewEncoder(conn), json.NewDecoder(conn)
+	err = f(func(req *Request) (*Response, error) {
+		if err := enc.Encode(req); err != nil {
+			return nil, err
+		}
+
+		var resp Response
+		if err := dec.Decode(&resp); err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// err returns the response's error, if any.
+func (r *Response) err() error {
+	switch {
+	case r.Error == "":
+		return nil
+	case r.Code != "":
+		return awserr.New(r.Code, r.Error, nil)
+	default:
+		return errors.New(r.Error)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerOf returns the process at the other end of the given Unix socket
+// connection, as recorded by the kernel when it connected.
+func peerOf(c net.Conn) (Peer, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return Peer{}, fmt.Errorf("not a Unix socket: %s", c.LocalAddr())
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return Peer{}, err
+	}
+
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return Peer{}, err
+	}
+
+	if credErr != nil {
+		return Peer{}, credErr
+	}
+	return Peer{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import (
+	"errors"
+	"net"
+)
+
+// peerOf always fails, as peer credentials are only supported on Linux, so
+// every request is denied.
+func peerOf(c net.Conn) (Peer, error) {
+	return Peer{}, errors.New("peer credentials are only supported on Linux")
+}
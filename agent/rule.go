@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"path"
+	"strings"
+)
+
+// Any matches any user or group in a Rule.
+const Any = -1
+
+// A Peer is the process at the other end of a connection to the agent.
+type Peer struct {
+	PID, UID, GID int
+}
+
+// A Rule allows processes run by a user, a group, or both to get the secrets
+// whose paths match a pattern. A Rule's zero value only allows root.
+type Rule struct {
+	// UID is the user the rule applies to, or Any.
+	UID int
+
+	// GID is the group the rule applies to, or Any. Only the peer's primary
+	// group is known, so supplementary groups don't count.
+	GID int
+
+	// Pattern is the pattern of secrets the rule allows, in the form used by
+	// sneaker.Manager.List.
+	Pattern string
+}
+
+// Allows returns whether the rule allows the given peer to get the secret with
+// the given path.
+func (r Rule) Allows(p Peer, secret string) bool {
+	if !r.appliesTo(p) || !validPath(secret) {
+		return false
+	}
+
+	for _, s := range strings.Split(r.Pattern, ",") {
+		if ok, err := path.Match(s, secret); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo returns whether the rule applies to the given peer, whatever the
+// secret.
+func (r Rule) appliesTo(p Peer) bool {
+	return (r.UID == Any || r.UID == p.UID) && (r.GID == Any || r.GID == p.GID)
+}
+
+// allowed returns whether any of the rules allow the given peer to get the
+// secret with the given path.
+func allowed(rules []Rule, p Peer, secret string) bool {
+	for _, r := range rules {
+		if r.Allows(p, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// applies returns whether any of the rules apply to the given peer, i.e.
+// whether it may get any secrets at all.
+func applies(rules []Rule, p Peer) bool {
+	for _, r := range rules {
+		if r.appliesTo(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validPath returns whether the given path is clean and relative. Managers
+// clean the paths of secrets, so others could escape the rules which match
+// them (e.g. app/../db/password matches app/*/*, but is db/password).
+func validPath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") || path.Clean(p) != p {
+		return false
+	}
+
+	for _, s := range strings.Split(p, "/") {
+		if s == "." || s == ".." {
+			return false
+		}
+	}
+	return true
+}
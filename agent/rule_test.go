@@ -0,0 +1,49 @@
+package agent
+
+import "testing"
+
+func TestRuleAllows(t *testing.T) {
+	peer := Peer{PID: 100, UID: 1000, GID: 50}
+
+	for _, tc := range []struct {
+		rule   Rule
+		secret string
+		want   bool
+	}{
+		{Rule{UID: 1000, GID: Any, Pattern: "app/*"}, "app/password", true},
+		{Rule{UID: 1000, GID: Any, Pattern: "app/*"}, "other/password", false},
+		{Rule{UID: 1000, GID: Any, Pattern: "app/*"}, "app/db/password", false},
+		{Rule{UID: Any, GID: 50, Pattern: "a,b/*"}, "b/c", true},
+		{Rule{UID: Any, GID: 51, Pattern: "*"}, "a", false},
+		{Rule{UID: 1000, GID: 50, Pattern: "*"}, "a", true},
+		{Rule{Pattern: "*"}, "a", false},
+		{Rule{UID: Any, GID: Any, Pattern: "[bad"}, "a", false},
+		{Rule{UID: Any, GID: Any, Pattern: "team/*/*"}, "team/../db", false},
+		{Rule{UID: Any, GID: Any, Pattern: "*"}, "/a", false},
+	} {
+		if v := tc.rule.Allows(peer, tc.secret); v != tc.want {
+			t.Errorf("%+v allowed %s: %v, but expected %v", tc.rule, tc.secret, v, tc.want)
+		}
+	}
+}
+
+func TestValidPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		"db/password":        true,
+		"a":                  true,
+		"":                   false,
+		".":                  false,
+		"/db/password":       false,
+		"team/../db":         false,
+		"..":                 false,
+		"../db":              false,
+		"team/./db":          false,
+		"team//db":           false,
+		"team/db/":           false,
+		"team/..db/password": true,
+	} {
+		if v := validPath(p); v != want {
+			t.Errorf("validPath(%q) was %v, but expected %v", p, v, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/codahale/sneaker"
+)
+
+// DefaultTTL is how long a Server serves secrets from its cache before
+// checking whether they've changed.
+const DefaultTTL = time.Minute
+
+// maxRequestSize is the most a Server reads of each request.
+const maxRequestSize = 64 << 10
+
+// A Server serves secrets from a Manager to the processes allowed by its
+// rules.
+type Server struct {
+	// Manager is where secrets are fetched from.
+	Manager *sneaker.Manager
+
+	// Rules are the secrets each user and group may get. Requests not allowed
+	// by any rule are denied, and listings only include the secrets the client
+	// may get.
+	Rules []Rule
+
+	// TTL is how long secrets are served from the cache before checking
+	// whether they've changed. If zero, DefaultTTL is used.
+	TTL time.Duration
+
+	// ErrorLog logs denied and failed requests. If nil, they're not logged.
+	ErrorLog *log.Logger
+
+	once  sync.Once
+	cache *cache
+}
+
+// Serve accepts connections on the given Unix socket listener and serves
+// requests on them until ctx is done, when it closes the listener and returns
+// nil. Connections are authorized by the credentials of the process which
+// connected, which are only available on Linux.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	s.once.Do(func() {
+		ttl := s.TTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		s.cache = newCache(s.Manager, ttl)
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, c)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, c net.Conn) {
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// unblock reads when the server stops
+	go func() {
+		<-ctx.Done()
+		_ = c.SetDeadline(time.Now())
+	}()
+
+	enc := json.NewEncoder(c)
+	peer, err := peerOf(c)
+	if err != nil {
+		s.logf("rejecting connection: %s", err)
+		_ = enc.Encode(&Response{Error: err.Error(), Code: CodeAccessDenied})
+		return
+	}
+
+	r := &io.LimitedReader{R: c}
+	dec := json.NewDecoder(r)
+	for {
+		// bound the memory a single request can use
+		r.N = maxRequestSize
+
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		if err := enc.Encode(s.handle(ctx, peer, &req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, peer Peer, req *Request) *Response {
+	switch req.Op {
+	case OpGet:
+		if !validPath(req.Path) {
+			s.logf("denied invalid path %q to pid %d (uid %d, gid %d)", req.Path, peer.PID, peer.UID, peer.GID)
+			return &Response{Error: "invalid path", Code: CodeAccessDenied}
+		}
+
+		if !allowed(s.Rules, peer, req.Path) {
+			s.logf("denied %s to pid %d (uid %d, gid %d)", req.Path, peer.PID, peer.UID, peer.GID)
+			return &Response{Error: "access denied", Code: CodeAccessDenied}
+		}
+
+		value, err := s.cache.get(ctx, req.Path)
+		if err != nil {
+			s.logf("error getting %s: %s", req.Path, err)
+			return errorResponse(err)
+		}
+		return &Response{Value: value}
+	case OpList:
+		// peers which can't get any secrets can't make the agent list them
+		if !applies(s.Rules, peer) {
+			s.logf("denied listing %s to pid %d (uid %d, gid %d)", req.Pattern, peer.PID, peer.UID, peer.GID)
+			return &Response{Error: "access denied", Code: CodeAccessDenied}
+		}
+
+		files, err := s.cache.list(ctx, req.Pattern)
+		if err != nil {
+			s.logf("error listing %s: %s", req.Pattern, err)
+			return errorResponse(err)
+		}
+
+		allowedFiles := make([]sneaker.File, 0, len(files))
+		for _, f := range files {
+			if allowed(s.Rules, peer, f.Path) {
+				allowedFiles = append(allowedFiles, f)
+			}
+		}
+		return &Response{Files: allowedFiles}
+	default:
+		return &Response{Error: fmt.Sprintf("unknown op: %q", req.Op)}
+	}
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, v...)
+	}
+}
+
+func errorResponse(err error) *Response {
+	resp := &Response{Error: err.Error()}
+	if sneaker.IsNotFound(err) {
+		resp.Code = CodeNotFound
+	}
+	return resp
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/codahale/sneaker"
+)
+
+func TestServer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on Linux")
+	}
+
+	man, keys, cleanup := testManager(t)
+	defer cleanup()
+
+	for path, secret := range map[string]string{
+		"app/password":   "hunter2",
+		"app/api.key":    "key",
+		"other/password": "hunter3",
+	} {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{
+		Manager: man,
+		Rules: []Rule{
+			{UID: os.Getuid(), GID: Any, Pattern: "app/*,missing"},
+			{UID: os.Getuid() + 1, GID: Any, Pattern: "other/*"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Serve(ctx, l) }()
+
+	client := &Client{Socket: socket}
+
+	for i := 0; i < 2; i++ {
+		secrets, err := client.Download([]string{"app/password", "app/api.key"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string][]byte{
+			"app/password": []byte("hunter2"),
+			"app/api.key":  []byte("key"),
+		}
+
+		if v, want := secrets, expected; !reflect.DeepEqual(v, want) {
+			t.Errorf("Secrets were %v, but expected %v", v, want)
+		}
+	}
+
+	if v, want := atomic.LoadInt32(&keys.decrypts), int32(2); v != want {
+		t.Errorf("Decrypted %d times, but expected %d", v, want)
+	}
+
+	_, err = client.Download([]string{"app/password", "other/password", "missing"})
+	errs, ok := err.(sneaker.PathErrors)
+	if !ok {
+		t.Fatalf("Error was %v, but expected PathErrors", err)
+	}
+
+	if e, ok := errs["other/password"].(awserr.Error); !ok || e.Code() != CodeAccessDenied {
+		t.Errorf("Error was %v, but expected access to be denied", errs["other/password"])
+	}
+
+	if err := errs["missing"]; !sneaker.IsNotFound(err) {
+		t.Errorf("Error was %v, but expected it to be not found", err)
+	}
+
+	if v, want := len(errs), 2; v != want {
+		t.Errorf("Got %d errors, but expected %d", v, want)
+	}
+
+	files, err := client.List("*/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	if v, want := paths, []string{"app/api.key", "app/password"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Listed %v, but expected %v", v, want)
+	}
+
+	// oversized requests are dropped
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		_, _ = conn.Write([]byte(`{"op": "get", "path": "` + strings.Repeat("a", maxRequestSize*2)))
+	}()
+
+	// the agent hangs up without responding
+	if b, _ := ioutil.ReadAll(conn); len(b) > 0 {
+		t.Errorf("Responded to an oversized request: %q", b)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.List("*"); err == nil {
+		t.Error("Connected to a stopped agent")
+	}
+}
+
+func TestServerHandle(t *testing.T) {
+	man, _, cleanup := testManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"db", "team/a/password"} {
+		if err := man.Upload(path, strings.NewReader("secret")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &Server{
+		Manager: man,
+		Rules:   []Rule{{UID: 1000, GID: Any, Pattern: "team/*/*"}},
+		cache:   newCache(man, time.Minute),
+	}
+	peer := Peer{PID: 1, UID: 1000, GID: 1000}
+
+	if resp := server.handle(context.Background(), peer, &Request{Op: OpGet, Path: "team/a/password"}); resp.Error != "" {
+		t.Errorf("Error was %q", resp.Error)
+	}
+
+	for _, path := range []string{"team/../db", "team/a/../../db", "/team/a/password", "team/./a/password"} {
+		resp := server.handle(context.Background(), peer, &Request{Op: OpGet, Path: path})
+		if resp.Code != CodeAccessDenied || resp.Value != nil {
+			t.Errorf("Got %s: %+v", path, resp)
+		}
+	}
+
+	if resp := server.handle(context.Background(), peer, &Request{Op: OpList, Pattern: "*"}); resp.Error != "" {
+		t.Errorf("Error was %q", resp.Error)
+	}
+
+	// peers no rule applies to can't list
+	stranger := Peer{PID: 2, UID: 2000, GID: 2000}
+	if resp := server.handle(context.Background(), stranger, &Request{Op: OpList, Pattern: "*"}); resp.Code != CodeAccessDenied {
+		t.Errorf("Listed for a stranger: %+v", resp)
+	}
+
+	if v := len(server.cache.listings); v != 1 {
+		t.Errorf("Cached %d listings, but expected 1", v)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codahale/sneaker"
+	"github.com/codahale/sneaker/agent"
+)
+
+// runAgent serves secrets from the manager on the given Unix socket until
+// interrupted.
+func runAgent(manager *sneaker.Manager, socket string, args map[string]interface{}) {
+	ttl, err := time.ParseDuration(args["--ttl"].(string))
+	if err != nil || ttl < 0 {
+		log.Fatalf("bad TTL: %q", args["--ttl"])
+	}
+
+	var rules []agent.Rule
+	for _, s := range args["--allow"].([]string) {
+		r, err := parseRule(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+
+	if len(rules) == 0 {
+		log.Fatal("no --allow rules given; every request would be denied")
+	}
+
+	// remove the socket left behind by a previous agent
+	if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socket); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(socket)
+
+	// any local user may connect; requests are authorized by the rules
+	if err := os.Chmod(socket, 0666); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := terminable()
+	defer cancel()
+
+	server := &agent.Server{
+		Manager:  manager,
+		Rules:    rules,
+		TTL:      ttl,
+		ErrorLog: log.New(os.Stderr, "", log.LstdFlags),
+	}
+
+	log.Printf("serving secrets on %s", socket)
+	if err := server.Serve(ctx, l); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseRule parses a rule given as who=pattern, where who is a user, :group,
+// or user:group, each a name, a numeric ID, or * for any.
+func parseRule(s string) (agent.Rule, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return agent.Rule{}, fmt.Errorf("bad rule: %q", s)
+	}
+
+	who, pattern := s[:i], s[i+1:]
+	name, group := who, "*"
+	if j := strings.IndexByte(who, ':'); j >= 0 {
+		name, group = who[:j], who[j+1:]
+	}
+
+	uid, err := lookupID(name, func(s string) (string, error) {
+		u, err := user.Lookup(s)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return agent.Rule{}, err
+	}
+
+	gid, err := lookupID(group, func(s string) (string, error) {
+		g, err := user.LookupGroup(s)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return agent.Rule{}, err
+	}
+
+	if pattern == "" {
+		return agent.Rule{}, fmt.Errorf("bad rule: %q", s)
+	}
+	return agent.Rule{UID: uid, GID: gid, Pattern: pattern}, nil
+}
+
+// lookupID returns the numeric ID of the given user or group, looking it up by
+// name if need be, or agent.Any for * or a blank name.
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if name == "" || name == "*" {
+		return agent.Any, nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	s, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+// source returns the agent given by $SNEAKER_AGENT, if any, or the manager.
+func source(manager *sneaker.Manager) agent.Source {
+	if s := os.Getenv("SNEAKER_AGENT"); s != "" {
+		return &agent.Client{Socket: s}
+	}
+	return manager
+}
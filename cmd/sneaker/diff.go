@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/codahale/sneaker"
+)
+
+// diff prints a unified diff of the plaintexts of two secrets, or of a secret
+// and a local file, and returns whether they differ. Secrets are decrypted in
+// memory, and never written to disk.
+func diff(manager *sneaker.Manager, a, b string, redact bool) (bool, error) {
+	sa, err := operand(manager, a, false)
+	if err != nil {
+		return false, err
+	}
+
+	sb, err := operand(manager, b, true)
+	if err != nil {
+		return false, err
+	}
+
+	return sneaker.Diff(os.Stdout, sa, sb, sneaker.DiffOptions{Redact: redact})
+}
+
+// operand returns the plaintext of a secret given as path or path@version. If
+// local is true and the name is marked as local (see localName), the file or
+// stdin is read instead.
+func operand(manager *sneaker.Manager, s string, local bool) (sneaker.Secret, error) {
+	if local {
+		if name, ok := localName(s); ok {
+			b, err := readLocal(name)
+			return sneaker.Secret{Path: s, Value: string(b)}, err
+		}
+	}
+
+	path, version := splitVersion(s)
+
+	var (
+		b   []byte
+		err error
+	)
+	if version == "" {
+		b, _, err = manager.DownloadWithETag(path)
+	} else {
+		b, err = manager.DownloadVersion(path, version)
+	}
+	return sneaker.Secret{Path: s, Value: string(b)}, err
+}
+
+// localName returns the name of the local file an operand refers to, and
+// whether it refers to one. Operands which are -, which start with ./, ../, or
+// /, or which are file: URLs are local files; everything else is a secret, so
+// a file can't shadow a secret with the same path.
+func localName(s string) (string, bool) {
+	if strings.HasPrefix(s, "file:") {
+		name := strings.TrimPrefix(s, "file:")
+		if strings.HasPrefix(name, "//") {
+			name = name[2:] // file:///etc/secret
+		}
+		return name, name != ""
+	}
+
+	if s == "-" || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") ||
+		strings.HasPrefix(s, "/") {
+		return s, true
+	}
+	return "", false
+}
+
+// versionID matches the version IDs of secrets: "null" for secrets stored
+// without versioning, or S3's 32-character, URL-safe version IDs.
+var versionID = regexp.MustCompile(`^(null|[A-Za-z0-9._+-]{32})$`)
+
+// splitVersion splits an operand into a path and, if it ends with @ and a
+// version ID, a version. Otherwise, an @ is part of the path, as in
+// users/bob@example.com.
+func splitVersion(s string) (string, string) {
+	if i := strings.LastIndexByte(s, '@'); i > 0 && versionID.MatchString(s[i+1:]) {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// readLocal reads the named file, or stdin if the name is -.
+func readLocal(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
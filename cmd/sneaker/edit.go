@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	fpath "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/codahale/sneaker"
+)
+
+// edit downloads the given secret, opens it in the user's editor, and uploads
+// the result if the secret hasn't been modified in the meantime. The plaintext
+// is kept in a private directory, preferably in memory, and is overwritten
+// before being removed.
+func edit(manager *sneaker.Manager, path string) error {
+	plaintext, etag, err := manager.DownloadWithETag(path)
+	if err != nil {
+		if !sneaker.IsNotFound(err) {
+			return err
+		}
+		log.Printf("%s does not exist, creating it", path)
+	}
+
+	dir, err := ioutil.TempDir(privateTempDir(), "sneaker")
+	if err != nil {
+		return err
+	}
+	defer shred(dir)
+
+	file := filepath.Join(dir, fpath.Base(path))
+	if err := ioutil.WriteFile(file, plaintext, 0600); err != nil {
+		return err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", editor[0], err)
+	}
+
+	edited, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if plaintext != nil && bytes.Equal(edited, plaintext) {
+		log.Printf("%s is unchanged", path)
+		return nil
+	}
+
+	log.Printf("uploading %s", path)
+
+	if err := manager.UploadIfMatch(path, bytes.NewReader(edited), etag); err != nil {
+		if err == sneaker.ErrModified {
+			return fmt.Errorf("%s was modified while you were editing it; try again", path)
+		}
+		return err
+	}
+	return nil
+}
+
+// privateTempDir returns a tmpfs directory, if one is available, so plaintext
+// is never written to a persistent disk.
+func privateTempDir() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if dir == "" {
+			continue
+		}
+
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
+
+// shred overwrites every file in the given directory with zeros before
+// removing the directory. This includes any swap or backup files left by the
+// editor.
+func shred(dir string) {
+	_ = filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		_, _ = f.Write(make([]byte, info.Size()))
+		_ = f.Sync()
+		return nil
+	})
+
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("unable to remove %s: %s", dir, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/codahale/sneaker"
+	"github.com/codahale/sneaker/agent"
+)
+
+// execWithSecrets downloads the secrets matching the given pattern, adds them
+// to the environment, and replaces this process with the given command. The
+// plaintext secrets are never written to disk.
+func execWithSecrets(src agent.Source, pattern string, names map[string]string, dotenv bool, command []string) {
+	files, err := src.ListContext(context.Background(), pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	secrets, err := src.DownloadContext(context.Background(), paths)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	for _, path := range paths {
+		if dotenv {
+			vars, err := sneaker.ParseDotenv(secrets[path])
+			if err != nil {
+				log.Fatalf("bad dotenv secret %s: %s", path, err)
+			}
+
+			for k, v := range vars {
+				env[k] = v
+			}
+			continue
+		}
+
+		name, ok := names[path]
+		if !ok {
+			name = sneaker.EnvName(path)
+		}
+		env[name] = string(secrets[path])
+	}
+
+	vars := make([]string, 0, len(env))
+	for k, v := range env {
+		vars = append(vars, k+"="+v)
+	}
+	sort.Strings(vars)
+
+	bin, err := exec.LookPath(command[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := execve(bin, command, vars); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// execve replaces this process with the given command.
+func execve(bin string, argv, env []string) error {
+	return syscall.Exec(bin, argv, env)
+}
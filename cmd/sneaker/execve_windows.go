@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// execve runs the given command and exits with its exit status, since Windows
+// can't replace a running process.
+func execve(bin string, argv, env []string) error {
+	cmd := exec.Command(bin, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.Sys().(interface {
+				ExitStatus() int
+			}).ExitStatus())
+		}
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	fpath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codahale/sneaker"
+)
+
+// export downloads the secrets matching the given pattern and writes them to w
+// as a single document in the given format, keyed by their full paths, as
+// transformed by keys. Secrets with names in names are keyed by those instead.
+func export(manager *sneaker.Manager, w io.Writer, pattern, format, keys string, names map[string]string) error {
+	if format == "" {
+		format = sneaker.FormatDotenv
+	}
+
+	_, key, err := keyFunc(format, keys)
+	if err != nil {
+		return err
+	}
+
+	files, err := manager.ListWithOptions(pattern, sneaker.ListOptions{SkipMetadata: true})
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	secrets, err := manager.Download(paths)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]byte, len(secrets))
+	from := make(map[string]string, len(secrets))
+	for _, path := range paths {
+		k, ok := names[path]
+		if !ok {
+			k = key(path)
+		}
+
+		if other, ok := from[k]; ok {
+			return fmt.Errorf("%s and %s are both exported as %s", other, path, k)
+		}
+		from[k] = path
+		values[k] = secrets[path]
+	}
+
+	return sneaker.Export(w, format, values)
+}
+
+// importSecrets reads a document in the given format, or if the format is
+// blank, the format indicated by its extension, and uploads each of its values
+// as a secret. Like export, keys are full paths, as transformed by keys, unless
+// they're given paths in names, which maps paths to keys. Keys transformed with
+// env or base are mapped back to the existing secrets under the given directory
+// which export would have given them, so exported secrets can be imported
+// again. Path keys which aren't under the directory are put under it.
+func importSecrets(manager *sneaker.Manager, file, dir, format, keys string, names map[string]string) error {
+	if format == "" {
+		switch filepath.Ext(file) {
+		case ".json":
+			format = sneaker.FormatJSON
+		case ".yaml", ".yml":
+			format = sneaker.FormatYAML
+		case ".sh":
+			format = sneaker.FormatShell
+		default:
+			format = sneaker.FormatDotenv
+		}
+	}
+
+	keys, key, err := keyFunc(format, keys)
+	if err != nil {
+		return err
+	}
+
+	in := openPath(file, os.Open, os.Stdin)
+	defer in.Close()
+
+	b, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	values, err := sneaker.Import(format, b)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %s", file, err)
+	}
+
+	paths := make(map[string]string, len(names))
+	for path, k := range names {
+		paths[k] = path
+	}
+
+	if dir != "" {
+		dir = fpath.Clean(dir)
+	}
+
+	// map transformed keys back to the secrets they were exported from
+	existing := map[string][]string{}
+	if keys != "path" {
+		if err := manager.WalkWithOptions("", sneaker.ListOptions{SkipMetadata: true}, func(f sneaker.File) error {
+			if dir == "" || strings.HasPrefix(f.Path, dir+"/") {
+				k := key(f.Path)
+				existing[k] = append(existing[k], f.Path)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	sorted := make([]string, 0, len(values))
+	for k := range values {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		path, err := importPath(k, dir, keys, paths, existing)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("uploading %s", path)
+
+		if err := manager.Upload(path, bytes.NewReader(values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPath returns the path of the secret with the given key: the path it's
+// given in paths, or the one existing secret which was exported with it.
+// Otherwise, the key is taken as a path, under the given directory if it isn't
+// already, unless it's an environment variable name, which can't be mapped
+// back to a path. Keys which aren't clean, relative paths are rejected, so they
+// can't escape the directory.
+func importPath(k, dir, keys string, paths map[string]string, existing map[string][]string) (string, error) {
+	if path, ok := paths[k]; ok {
+		return path, nil
+	}
+
+	switch matches := existing[k]; {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) > 1:
+		return "", fmt.Errorf("%s could be any of %s; name it with --env", k, strings.Join(matches, ", "))
+	case keys == "env":
+		return "", fmt.Errorf("no secret is exported as %s; name it with --env, or use --keys=path", k)
+	}
+
+	if k == "" || fpath.IsAbs(k) || fpath.Clean(k) != k || k == ".." || strings.HasPrefix(k, "../") {
+		return "", fmt.Errorf("%q isn't a clean, relative path", k)
+	}
+
+	if dir == "" || strings.HasPrefix(k, dir+"/") {
+		return k, nil
+	}
+	return fpath.Join(dir, k), nil
+}
+
+// keyFunc returns how secrets' paths are transformed into keys in a document
+// of the given format, and the function which does so: by path, env, or base,
+// or if keys is blank, by path for JSON and YAML, and by env for dotenv and
+// shell.
+func keyFunc(format, keys string) (string, func(string) string, error) {
+	if keys == "" {
+		keys = "path"
+		if format == sneaker.FormatDotenv || format == sneaker.FormatShell {
+			keys = "env"
+		}
+	}
+
+	switch keys {
+	case "path":
+		return keys, func(path string) string { return path }, nil
+	case "env":
+		return keys, sneaker.EnvName, nil
+	case "base":
+		return keys, fpath.Base, nil
+	default:
+		return "", nil, fmt.Errorf("unknown key transformation: %q", keys)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codahale/sneaker"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	manager, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"app/db/password", "app/api-key", "other/api-key"} {
+		if err := manager.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sneaker export 'app/*,app/*/*' > app.env
+	buf := new(bytes.Buffer)
+	if err := export(manager, buf, "app/*,app/*/*", sneaker.FormatDotenv, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(manager.Objects.(*sneaker.FileStorage).Root, "app.env")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"app/db/password", "app/api-key"} {
+		if err := manager.Upload(path, strings.NewReader("changed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sneaker import app.env app
+	if err := importSecrets(manager, file, "app", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := manager.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 3; v != want {
+		t.Errorf("Had %d secrets, but expected %d", v, want)
+	}
+
+	secrets, err := manager.Download([]string{"app/db/password", "app/api-key", "other/api-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, secret := range secrets {
+		if v, want := string(secret), path; v != want {
+			t.Errorf("%s was %q, but expected %q", path, v, want)
+		}
+	}
+}
+
+func TestImportPathEscape(t *testing.T) {
+	for _, k := range []string{"../x", "/x", "a/../../x", "./x", ""} {
+		if path, err := importPath(k, "app", "path", nil, nil); err == nil {
+			t.Errorf("%q was imported as %q", k, path)
+		}
+	}
+
+	for k, want := range map[string]string{
+		"db/password":     "app/db/password",
+		"app/db/password": "app/db/password",
+	} {
+		path, err := importPath(k, "app", "path", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path != want {
+			t.Errorf("%q was imported as %q, but expected %q", k, path, want)
+		}
+	}
+}
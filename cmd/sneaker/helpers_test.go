@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/codahale/sneaker"
+)
+
+// testFileManager returns a Manager which stores secrets in a temporary
+// directory, encrypted with key1 of a local keyring, and a func which removes
+// the directory.
+func testFileManager(t *testing.T) (*sneaker.Manager, func()) {
+	root, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := new(sneaker.Keyring)
+	if err := keyring.AddKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	return &sneaker.Manager{
+		Objects: &sneaker.FileStorage{Root: root},
+		Envelope: sneaker.Envelope{
+			KMS: keyring,
+		},
+		KeyId:  "key1",
+		Bucket: "bucket",
+	}, func() { _ = os.RemoveAll(root) }
+}
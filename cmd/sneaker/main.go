@@ -3,40 +3,134 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/codahale/sneaker"
+	"github.com/codahale/sneaker/internal/atomicfile"
 	"github.com/docopt/docopt-go"
 )
 
 const usage = `sneaker manages secrets.
 
 Usage:
-  sneaker ls [<pattern>]
-  sneaker upload <file> <path>
+  sneaker ls [<pattern>] [--key=<id>] [--format=<format>]
+  sneaker upload <file> <path> [--if-changed]
   sneaker download <path> <file>
+  sneaker edit <path>
   sneaker rm <path>
-  sneaker pack <pattern> <file> [--key=<id>] [--context=<k1=v2,k2=v2>]
+  sneaker cp <pattern> <dest> [--force]
+  sneaker mv <pattern> <dest> [--force]
+  sneaker undelete <path>
+  sneaker trash ls
+  sneaker trash purge [--older-than=<age>]
+  sneaker log <path>
+  sneaker diff <path> <other> [--redact]
+  sneaker revert <path> <version>
+  sneaker pack <pattern> <file> [--key=<id>] [--context=<k1=v2,k2=v2>] [--format=<format>]
   sneaker unpack <file> <path> [--context=<k1=v2,k2=v2>]
-  sneaker rotate [<pattern>]
+  sneaker unpack <file> --into=<dir> [--only=<pattern>] [--context=<k1=v2,k2=v2>] [--owner=<owner>] [--mode=<mode>] [--prune]
+  sneaker unpack <file> --list [--context=<k1=v2,k2=v2>] [--format=<format>]
+  sneaker rotate [<pattern>] [--format=<format>]
+  sneaker export <pattern> [--format=<format>] [--keys=<keys>] [--env=<p1=N1,p2=N2>]
+  sneaker import <file> [<path>] [--format=<format>] [--keys=<keys>] [--env=<p1=N1,p2=N2>]
+  sneaker render <template> <output>
+  sneaker rekey [<pattern>] [--to-key=<id>] [--to-context=<k1=v2,k2=v2>] [--dry-run]
+  sneaker exec [--dotenv] [--env=<p1=N1,p2=N2>] <pattern> [--] <command>...
+  sneaker agent <socket> --allow=<rule>... [--ttl=<ttl>]
+  sneaker sync push <dir> <prefix> [--delete] [--dry-run]
+  sneaker sync pull <prefix> <dir> [--delete] [--dry-run]
+  sneaker watch <pattern> --into=<dir> [--interval=<interval>] [--exec-on-change=<command>] [--pid=<pid>] [--signal=<signal>]
+  sneaker keyring create <file>
+  sneaker keyring add-key <file> <id>
+  sneaker keyring list <file>
   sneaker version
 
+Arguments:
+  <other>    With diff, a secret, as path or path@version, or a local file
+             starting with ./, ../, /, or file: (or - for stdin).
+
 Options:
   -h --help  Show this help information.
+  --dotenv   Parse secrets as NAME=value lines, one variable per line.
+  --key=<id>           With ls, only list secrets encrypted under this KMS key.
+                       With pack, the KMS key to encrypt the pack with.
+  --to-key=<id>        The KMS key to re-encrypt secrets with (default:
+                       $SNEAKER_MASTER_KEY).
+  --to-context=<k1=v2,k2=v2>  The encryption context to re-encrypt secrets
+                              with (default: $SNEAKER_MASTER_CONTEXT).
+  --dry-run            Show which secrets would be re-encrypted or synced,
+                       without changing anything.
+  --if-changed         Only upload the secret if its contents have changed,
+                       comparing them by digest.
+  --delete             With sync, delete secrets or files which aren't in the
+                       source.
+  --force              With cp and mv, move secrets which already exist at the
+                       destination to the trash, and replace them.
+  --format=<format>    Print results as a table, json, jsonl, csv, or with a Go
+                       template (e.g. '{{.Path}} {{.Size}}'). By default, ls
+                       and unpack --list print a table, and rotate and pack
+                       only log progress.
+                       With export and import, the document format: dotenv,
+                       shell, json, or yaml (default: dotenv, or for import,
+                       the file's extension).
+  --keys=<keys>        How to name exported secrets: by path, env (e.g.
+                       DB_PASSWORD), or base (e.g. password). By default, json
+                       and yaml use paths, and dotenv and shell use env. With
+                       import, how the document's keys were named.
+  --into=<dir>         With unpack, extract the secrets into this directory,
+                       replacing it. With watch, keep the secrets in this
+                       directory up to date.
+  --only=<pattern>     Only extract the secrets matching this pattern.
+  --list               List the secrets in the pack from its manifest.
+  --owner=<owner>      The owner of extracted secrets, as user:group or user
+                       (default: the current user).
+  --mode=<mode>        The permissions of extracted secrets [default: 0400].
+  --prune              Remove files which aren't in the pack.
+  --redact             With diff, only show which keys (of JSON and dotenv
+                       secrets) or lines changed, not what they contain.
+  --older-than=<age>   Only purge secrets deleted longer ago than this (e.g.
+                       30d or 12h) [default: 30d].
+  --allow=<rule>       Allow a user, group, or both to get secrets from the
+                       agent, as who=pattern (e.g. app=app/*, :web=certs/*,
+                       or deploy:ops=*). May be given more than once.
+  --ttl=<ttl>          How long the agent serves secrets before checking
+                       whether they've changed [default: 1m].
+  --interval=<interval>  How often to check for changed secrets [default: 30s].
+  --exec-on-change=<command>  A shell command to run after secrets change.
+  --pid=<pid>          A process ID, or a file containing one, to signal
+                       after secrets change.
+  --signal=<signal>    The signal to send to --pid [default: HUP].
+  --env=<p1=N1,p2=N2>  Environment variable names for the given secrets. By
+                       default, db/password is exposed as DB_PASSWORD. With
+                       export and import, the keys of the given secrets.
 
 Environment Variables:
   SNEAKER_MASTER_KEY      The KMS key to use when encrypting secrets.
   SNEAKER_MASTER_CONTEXT  The KMS encryption context to use for stored secrets.
-  SNEAKER_S3_PATH         Where secrets will be stored (e.g. s3://bucket/path).
+  SNEAKER_S3_PATH         Where secrets will be stored (e.g. s3://bucket/path
+                          or file:///path/on/disk).
+  SNEAKER_KMS             Use a local keyring instead of KMS (e.g.
+                          file:///path/to/keyring).
+  SNEAKER_CONCURRENCY     The number of secrets to download or rotate at once
+                          (default: 1).
+  SNEAKER_AGENT           Get secrets from the agent listening on this socket
+                          with download and exec.
 `
 
 func main() {
@@ -53,8 +147,18 @@ func main() {
 		return
 	}
 
+	if args["keyring"] == true {
+		keyring(args)
+		return
+	}
+
 	manager := loadManager()
 
+	if args["trash"] == true {
+		trash(manager, args)
+		return
+	}
+
 	if args["ls"] == true {
 		// sneaker ls
 		// sneaker ls *.txt,*.key
@@ -69,18 +173,36 @@ func main() {
 			log.Fatal(err)
 		}
 
-		table := new(tabwriter.Writer)
-		table.Init(os.Stdout, 2, 0, 2, ' ', 0)
-		fmt.Fprintln(table, "key\tmodified\tsize\tetag")
+		if s, ok := args["--key"].(string); ok {
+			files = filterKey(manager, files, s)
+		}
+
+		out, err := newOutput(os.Stdout, format(args), fileRecord{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		for _, f := range files {
-			fmt.Fprintf(table, "%s\t%s\t%v\t%s\n",
-				f.Path,
-				f.LastModified.Format(conciseTime),
-				f.Size,
-				f.ETag,
-			)
+			if f.KeyId == "" && out.format == "table" {
+				f.KeyId = "unknown"
+			}
+
+			if err := out.write(fileRecord{
+				Path:          f.Path,
+				LastModified:  f.LastModified,
+				Size:          f.Size,
+				ETag:          f.ETag,
+				KeyId:         f.KeyId,
+				FormatVersion: f.FormatVersion,
+				Digest:        f.Digest,
+			}); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := out.close(); err != nil {
+			log.Fatal(err)
 		}
-		_ = table.Flush()
 
 	} else if args["upload"] == true {
 		file := args["<file>"].(string)
@@ -91,7 +213,26 @@ func main() {
 		f := openPath(file, os.Open, os.Stdin)
 		defer f.Close()
 
-		if err := manager.Upload(path, f); err != nil {
+		var r io.Reader = f
+		if args["--if-changed"] == true {
+			b, err := ioutil.ReadAll(f)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			unchanged, err := manager.Unchanged(path, b)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if unchanged {
+				log.Printf("%s is unchanged", path)
+				return
+			}
+			r = bytes.NewReader(b)
+		}
+
+		if err := manager.Upload(path, r); err != nil {
 			log.Fatal(err)
 		}
 	} else if args["download"] == true {
@@ -100,14 +241,28 @@ func main() {
 
 		log.Printf("downloading %s", file)
 
-		out := openPath(file, os.Create, os.Stdout)
-		defer out.Close()
+		if err := createPath(file, os.Stdout, func(out io.Writer) error {
+			src := source(manager)
+			if m, ok := src.(*sneaker.Manager); ok {
+				return m.DownloadTo(path, out)
+			}
 
-		actual, err := manager.Download([]string{path})
-		if err != nil {
+			secrets, err := src.DownloadContext(context.Background(), []string{path})
+			if err != nil {
+				return err
+			}
+
+			_, err = out.Write(secrets[path])
+			return err
+		}); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["edit"] == true {
+		path := args["<path>"].(string)
+
+		if err := edit(manager, path); err != nil {
 			log.Fatal(err)
 		}
-		out.Write(actual[path])
 	} else if args["rm"] == true {
 		path := args["<path>"].(string)
 
@@ -116,6 +271,82 @@ func main() {
 		if err := manager.Rm(path); err != nil {
 			log.Fatal(err)
 		}
+	} else if args["cp"] == true || args["mv"] == true {
+		pattern := args["<pattern>"].(string)
+		dest := args["<dest>"].(string)
+
+		if err := move(manager, pattern, dest, args["cp"] == true, args["--force"] == true); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["undelete"] == true {
+		path := args["<path>"].(string)
+
+		log.Printf("restoring %s", path)
+
+		if err := manager.Undelete(path); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["log"] == true {
+		path := args["<path>"].(string)
+
+		versions, err := manager.History(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		table := new(tabwriter.Writer)
+		table.Init(os.Stdout, 2, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "version\tmodified\tsize\tetag\tstatus")
+		for _, v := range versions {
+			var status string
+			switch {
+			case v.DeleteMarker:
+				status = "deleted"
+			case v.IsLatest:
+				status = "latest"
+			}
+
+			size := fmt.Sprint(v.Size)
+			if v.DeleteMarker {
+				size = "-"
+			}
+
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+				v.VersionId,
+				v.LastModified.Format(time.RFC3339),
+				size,
+				v.ETag,
+				status,
+			)
+		}
+		_ = table.Flush()
+	} else if args["diff"] == true {
+		// sneaker diff db/password ./password
+		// sneaker diff db/password@<version> db/password
+
+		a := args["<path>"].(string)
+		b := args["<other>"].(string)
+
+		// like diff(1), exit with 1 if there are differences and 2 if
+		// there's trouble
+		changed, err := diff(manager, a, b, args["--redact"] == true)
+		if err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+
+		if changed {
+			os.Exit(1)
+		}
+	} else if args["revert"] == true {
+		path := args["<path>"].(string)
+		versionID := args["<version>"].(string)
+
+		log.Printf("reverting %s to %s", path, versionID)
+
+		if err := manager.Revert(path, versionID); err != nil {
+			log.Fatal(err)
+		}
 	} else if args["pack"] == true {
 		pattern := args["<pattern>"].(string)
 		file := args["<file>"].(string)
@@ -135,7 +366,7 @@ func main() {
 		}
 
 		// list files
-		files, err := manager.List(pattern)
+		files, err := manager.ListWithOptions(pattern, sneaker.ListOptions{SkipMetadata: true})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -147,23 +378,47 @@ func main() {
 
 		log.Printf("packing %v", paths)
 
-		// download secrets
-		secrets, err := manager.Download(paths)
-		if err != nil {
-			log.Fatal(err)
+		// report to STDOUT, unless the pack is written there
+		var results *output
+		if s := format(args); s != "" {
+			w := io.Writer(os.Stdout)
+			if file == "-" {
+				w = os.Stderr
+			}
+
+			results, err = newOutput(w, s, packRecord{})
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 
-		// write to file or STDOUT
-		out := openPath(file, os.Create, os.Stdout)
-		defer out.Close()
+		// download and pack secrets to file or STDOUT
+		started := time.Now()
+		err = createPath(file, os.Stdout, func(out io.Writer) error {
+			return manager.PackPaths(paths, context, key, out)
+		})
+
+		if results != nil {
+			if err := results.write(packRecord{
+				File:       file,
+				Paths:      paths,
+				Started:    started,
+				DurationMs: milliseconds(time.Since(started)),
+				Error:      errorString(err),
+			}); err != nil {
+				log.Fatal(err)
+			}
 
-		// pack secrets
-		if err := manager.Pack(secrets, context, key, out); err != nil {
+			if err := results.close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err != nil {
 			log.Fatal(err)
 		}
 	} else if args["unpack"] == true {
 		file := args["<file>"].(string)
-		path := args["<path>"].(string)
 		var context map[string]string
 		if s, ok := args["--context"].(string); ok {
 			c, err := parseContext(s)
@@ -173,20 +428,36 @@ func main() {
 			context = c
 		}
 
+		if dir, ok := args["--into"].(string); ok {
+			if err := unpackInto(manager, file, dir, context, args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if args["--list"] == true {
+			if err := unpackList(manager, file, context, format(args)); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		path := args["<path>"].(string)
+
 		// read from file or STDIN
 		in := openPath(file, os.Open, os.Stdin)
 		defer in.Close()
 
 		// write to file or STDOUT
-		out := openPath(path, os.Create, os.Stdout)
-		defer out.Close()
-
-		r, err := manager.Unpack(context, in)
-		if err != nil {
-			log.Fatal(err)
-		}
+		if err := createPath(path, os.Stdout, func(out io.Writer) error {
+			r, err := manager.Unpack(context, in)
+			if err != nil {
+				return err
+			}
 
-		if _, err := io.Copy(out, r); err != nil {
+			_, err = io.Copy(out, r)
+			return err
+		}); err != nil {
 			log.Fatal(err)
 		}
 	} else if args["rotate"] == true {
@@ -195,11 +466,128 @@ func main() {
 			pattern = s
 		}
 
-		if err := manager.Rotate(pattern, func(s string) {
+		ctx, cancel := interruptible()
+		defer cancel()
+
+		if s := format(args); s != "" {
+			out, err := newOutput(os.Stdout, s, resultRecord{})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			err = manager.RotateResultsContext(ctx, pattern, func(r sneaker.Result) {
+				if err := out.write(resultRecord{
+					Path:       r.Path,
+					Started:    r.Started,
+					DurationMs: milliseconds(r.Duration),
+					Error:      errorString(r.Err),
+				}); err != nil {
+					log.Fatal(err)
+				}
+			})
+
+			if err := out.close(); err != nil {
+				log.Fatal(err)
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if err := manager.RotateContext(ctx, pattern, func(s string) {
 			log.Printf("rotating %s", s)
 		}); err != nil {
 			log.Fatal(err)
 		}
+	} else if args["export"] == true {
+		pattern := args["<pattern>"].(string)
+
+		var keys string
+		if s, ok := args["--keys"].(string); ok {
+			keys = s
+		}
+
+		if err := export(manager, os.Stdout, pattern, format(args), keys, names(args)); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["import"] == true {
+		file := args["<file>"].(string)
+
+		var dir string
+		if s, ok := args["<path>"].(string); ok {
+			dir = s
+		}
+
+		var keys string
+		if s, ok := args["--keys"].(string); ok {
+			keys = s
+		}
+
+		if err := importSecrets(manager, file, dir, format(args), keys, names(args)); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["render"] == true {
+		file := args["<template>"].(string)
+		output := args["<output>"].(string)
+
+		if err := render(manager, file, output); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["rekey"] == true {
+		var pattern string
+		if s, ok := args["<pattern>"].(string); ok {
+			pattern = s
+		}
+
+		var key string
+		if s, ok := args["--to-key"].(string); ok {
+			key = s
+		}
+
+		var context map[string]string
+		if s, ok := args["--to-context"].(string); ok {
+			c, err := parseContext(s)
+			if err != nil {
+				log.Fatal(err)
+			}
+			context = c
+		}
+
+		dryRun := args["--dry-run"] == true
+
+		ctx, cancel := interruptible()
+		defer cancel()
+
+		results, err := manager.RekeyContext(ctx, pattern, key, context, dryRun)
+
+		table := new(tabwriter.Writer)
+		table.Init(os.Stdout, 2, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "key\tcurrent key\tstatus")
+		for _, r := range results {
+			status := "unchanged"
+			switch {
+			case r.Changed && dryRun:
+				status = "would re-key"
+			case r.Changed:
+				status = "re-keyed"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\n", r.Path, r.KeyID, status)
+		}
+		_ = table.Flush()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if args["exec"] == true {
+		pattern := args["<pattern>"].(string)
+		command := args["<command>"].([]string)
+
+		execWithSecrets(source(manager), pattern, names(args), args["--dotenv"] == true, command)
+	} else if args["agent"] == true {
+		runAgent(manager, args["<socket>"].(string), args)
+	} else if args["sync"] == true {
+		syncSecrets(manager, args)
+	} else if args["watch"] == true {
+		watch(manager, args["<pattern>"].(string), args["--into"].(string), args)
 	} else {
 		fmt.Fprintf(os.Stderr, "Unknown command: %v\n", os.Args)
 	}
@@ -210,24 +598,118 @@ func loadManager() *sneaker.Manager {
 	if err != nil {
 		log.Fatalf("bad SNEAKER_S3_PATH: %s", err)
 	}
-	if u.Path != "" && u.Path[0] == '/' {
-		u.Path = u.Path[1:]
-	}
 
 	ctxt, err := parseContext(os.Getenv("SNEAKER_MASTER_CONTEXT"))
 	if err != nil {
 		log.Fatalf("bad SNEAKER_MASTER_CONTEXT: %s", err)
 	}
 
+	var objects sneaker.ObjectStorage
+	switch u.Scheme {
+	case "file":
+		root, ok := filePath(u)
+		if !ok {
+			log.Fatalf("bad SNEAKER_S3_PATH: %q is not an absolute file:/// URL", os.Getenv("SNEAKER_S3_PATH"))
+		}
+		objects = &sneaker.FileStorage{Root: root}
+		u.Host, u.Path = "", ""
+	default:
+		objects = s3.New(session.New())
+	}
+
+	if u.Path != "" && u.Path[0] == '/' {
+		u.Path = u.Path[1:]
+	}
+
+	var keys sneaker.KeyManagement = kms.New(session.New())
+	if s := os.Getenv("SNEAKER_KMS"); s != "" {
+		u, err := url.Parse(s)
+		if err != nil {
+			log.Fatalf("bad SNEAKER_KMS: %s", err)
+		}
+
+		file, ok := filePath(u)
+		if !ok {
+			log.Fatalf("bad SNEAKER_KMS: %q is not an absolute file:/// URL", s)
+		}
+
+		k, err := sneaker.LoadKeyring(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = k
+	}
+
+	concurrency := 1
+	if s := os.Getenv("SNEAKER_CONCURRENCY"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			log.Fatalf("bad SNEAKER_CONCURRENCY: %q", s)
+		}
+		concurrency = n
+	}
+
 	return &sneaker.Manager{
-		Objects: s3.New(session.New()),
+		Objects: objects,
 		Envelope: sneaker.Envelope{
-			KMS: kms.New(session.New()),
+			KMS: keys,
 		},
 		Bucket:            u.Host,
 		Prefix:            u.Path,
 		EncryptionContext: ctxt,
 		KeyId:             os.Getenv("SNEAKER_MASTER_KEY"),
+		Concurrency:       concurrency,
+	}
+}
+
+// filePath returns the path of the given file:/// URL. file:///srv/secrets
+// refers to /srv/secrets, but file://srv/secrets would silently refer to
+// /secrets on a host named srv, so only absolute paths without hosts are
+// accepted.
+func filePath(u *url.URL) (string, bool) {
+	if u.Scheme != "file" || u.Host != "" || u.Opaque != "" || !strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	return u.Path, true
+}
+
+func keyring(args map[string]interface{}) {
+	file := args["<file>"].(string)
+
+	if args["create"] == true {
+		if _, err := os.Stat(file); err == nil {
+			log.Fatalf("%s already exists", file)
+		}
+
+		log.Printf("creating keyring %s", file)
+
+		if err := new(sneaker.Keyring).Save(file); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	k, err := sneaker.LoadKeyring(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if args["add-key"] == true {
+		id := args["<id>"].(string)
+
+		log.Printf("adding key %s", id)
+
+		if err := k.AddKey(id); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := k.Save(file); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["list"] == true {
+		for _, id := range k.KeyIDs() {
+			fmt.Println(id)
+		}
 	}
 }
 
@@ -247,6 +729,34 @@ func parseContext(s string) (map[string]string, error) {
 	return context, nil
 }
 
+// filterKey returns the files encrypted under the given KMS key. Secrets record
+// the ARNs of their keys, so key IDs and aliases are resolved if possible.
+func filterKey(manager *sneaker.Manager, files []sneaker.File, keyID string) []sneaker.File {
+	arn, err := manager.Envelope.ResolveKey(keyID)
+	if err != nil {
+		log.Printf("unable to resolve %s, matching it exactly: %s", keyID, err)
+		arn = keyID
+	}
+
+	var matched []sneaker.File
+	for _, f := range files {
+		if f.KeyId == arn || f.KeyId == keyID {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+// createPath calls f with the named file, or def if the name is -. The file is
+// only replaced once f has succeeded, so a failed download never leaves a
+// partial or unauthenticated secret behind.
+func createPath(file string, def *os.File, f func(io.Writer) error) error {
+	if file == "-" {
+		return f(def)
+	}
+	return atomicfile.Write(file, 0600, f)
+}
+
 func openPath(file string, o func(string) (*os.File, error), def *os.File) *os.File {
 	if file == "-" {
 		return def
@@ -258,6 +768,65 @@ func openPath(file string, o func(string) (*os.File, error), def *os.File) *os.F
 	return f
 }
 
-const (
-	conciseTime = "2006-01-02T15:04"
-)
+// names returns the names of secrets given with --env, if any.
+func names(args map[string]interface{}) map[string]string {
+	s, ok := args["--env"].(string)
+	if !ok {
+		return nil
+	}
+
+	names, err := parseContext(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return names
+}
+
+// format returns the output format given with --format, if any.
+func format(args map[string]interface{}) string {
+	if s, ok := args["--format"].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// interruptible returns a context which is cancelled when the process is
+// interrupted, so long-running commands can stop between secrets. A second
+// interrupt kills the process as usual.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		select {
+		case <-c:
+			log.Println("interrupted, stopping")
+			signal.Stop(c)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// terminable returns a context which is cancelled when the process is
+// interrupted or terminated, so daemons can clean up before exiting.
+func terminable() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-c:
+			log.Printf("received %s, stopping", s)
+			signal.Stop(c)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/codahale/sneaker"
+)
+
+// move copies or moves the secrets matching the given pattern. If the
+// destination ends with a slash, each secret keeps its path relative to the
+// directory of the pattern (e.g. staging/db/password matches staging/*/* and
+// becomes prod/db/password for prod/). Otherwise, the pattern must match a
+// single secret, which is given the destination path. Secrets which already
+// exist at the destination are only replaced if force is true.
+func move(manager *sneaker.Manager, pattern, dest string, keep, force bool) error {
+	files, err := manager.ListWithOptions(pattern, sneaker.ListOptions{SkipMetadata: true})
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no secrets match %s", pattern)
+	}
+
+	if !strings.HasSuffix(dest, "/") && len(files) > 1 {
+		return fmt.Errorf("%s matches %d secrets, so the destination must end with /", pattern, len(files))
+	}
+
+	verb, f := "moving", manager.Move
+	if keep {
+		verb, f = "copying", manager.Copy
+	}
+
+	for _, file := range files {
+		dst := dest
+		if strings.HasSuffix(dest, "/") {
+			dst = dest + strings.TrimPrefix(file.Path, patternDir(pattern, file.Path))
+		}
+
+		log.Printf("%s %s to %s", verb, file.Path, dst)
+
+		if err := f(file.Path, dst, force); err != nil {
+			return fmt.Errorf("%s: %s", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// patternDir returns the directory of whichever of the comma-separated patterns
+// matches the given path, up to its first wildcard.
+func patternDir(pattern, name string) string {
+	for _, p := range strings.Split(pattern, ",") {
+		if ok, _ := path.Match(p, name); !ok {
+			continue
+		}
+
+		if i := strings.IndexAny(p, `*?[\`); i >= 0 {
+			p = p[:i]
+		}
+
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			return p[:i+1]
+		}
+		return ""
+	}
+	return ""
+}
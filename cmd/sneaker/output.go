@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// An output writes records in the format given with --format: an aligned table
+// (the default), a JSON array, one JSON object per line, CSV with a header
+// row, or a Go template, which is executed for each record.
+//
+// Records are structs. In JSON, their fields are named by their json tags; in
+// tables and CSV, columns are named by their header tags, if any, or their
+// json tags, and times are formatted as RFC 3339.
+type output struct {
+	w       io.Writer
+	format  string
+	columns []string
+	n       int
+
+	table *tabwriter.Writer
+	csv   *csv.Writer
+	tmpl  *template.Template
+}
+
+// newOutput returns an output which writes records like the given zero record
+// to w in the given format.
+func newOutput(w io.Writer, format string, zero interface{}) (*output, error) {
+	o := &output{w: w, format: format}
+
+	t := reflect.TypeOf(zero)
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("header")
+		if name == "" {
+			name = strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		}
+		o.columns = append(o.columns, name)
+	}
+
+	switch {
+	case format == "" || format == "table":
+		o.format = "table"
+		o.table = tabwriter.NewWriter(w, 2, 0, 2, ' ', 0)
+		fmt.Fprintln(o.table, strings.Join(o.columns, "\t"))
+	case format == "csv":
+		o.csv = csv.NewWriter(w)
+		if err := o.csv.Write(o.columns); err != nil {
+			return nil, err
+		}
+	case format == "json" || format == "jsonl":
+	case strings.Contains(format, "{{"):
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("bad format: %s", err)
+		}
+		o.format = "template"
+		o.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("unknown format: %q", format)
+	}
+	return o, nil
+}
+
+// write writes the given record.
+func (o *output) write(record interface{}) error {
+	defer func() { o.n++ }()
+
+	switch o.format {
+	case "table":
+		_, err := fmt.Fprintln(o.table, strings.Join(values(record), "\t"))
+		return err
+	case "csv":
+		return o.csv.Write(values(record))
+	case "json":
+		sep := ",\n  "
+		if o.n == 0 {
+			sep = "[\n  "
+		}
+
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(o.w, "%s%s", sep, b)
+		return err
+	case "jsonl":
+		return json.NewEncoder(o.w).Encode(record)
+	default:
+		if err := o.tmpl.Execute(o.w, record); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(o.w)
+		return err
+	}
+}
+
+// close writes anything which follows the records.
+func (o *output) close() error {
+	switch o.format {
+	case "table":
+		return o.table.Flush()
+	case "csv":
+		o.csv.Flush()
+		return o.csv.Error()
+	case "json":
+		end := "\n]\n"
+		if o.n == 0 {
+			end = "[]\n"
+		}
+		_, err := io.WriteString(o.w, end)
+		return err
+	}
+	return nil
+}
+
+// values returns the fields of the given record as strings.
+func values(record interface{}) []string {
+	v := reflect.ValueOf(record)
+	s := make([]string, v.NumField())
+	for i := range s {
+		switch f := v.Field(i).Interface().(type) {
+		case time.Time:
+			if !f.IsZero() {
+				s[i] = f.Format(time.RFC3339)
+			}
+		case []string:
+			s[i] = strings.Join(f, ",")
+		default:
+			s[i] = fmt.Sprint(f)
+		}
+	}
+	return s
+}
+
+// A fileRecord is a secret, as listed by ls.
+type fileRecord struct {
+	Path          string    `json:"path" header:"key"`
+	LastModified  time.Time `json:"last_modified" header:"modified"`
+	Size          int       `json:"size"`
+	ETag          string    `json:"etag"`
+	KeyId         string    `json:"key_id" header:"kms key"`
+	FormatVersion int       `json:"format_version" header:"format"`
+	Digest        string    `json:"digest"`
+}
+
+// An entryRecord is a secret in a pack, as listed by unpack --list.
+type entryRecord struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag"`
+}
+
+// A resultRecord is the result of an operation on a single secret, like
+// rotating it.
+type resultRecord struct {
+	Path       string    `json:"path"`
+	Started    time.Time `json:"started"`
+	DurationMs float64   `json:"duration_ms" header:"duration (ms)"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// A packRecord is the result of packing secrets.
+type packRecord struct {
+	File       string    `json:"file"`
+	Paths      []string  `json:"paths"`
+	Started    time.Time `json:"started"`
+	DurationMs float64   `json:"duration_ms" header:"duration (ms)"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// milliseconds returns the given duration in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// errorString returns the given error's message, or an empty string if it's
+// nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/codahale/sneaker"
+	"github.com/codahale/sneaker/internal/atomicfile"
+)
+
+// render executes the given template with the secrets it uses, and atomically
+// writes the output to the given file, which only its owner can read. If the
+// output is -, it's written to STDOUT instead.
+func render(manager *sneaker.Manager, file, output string) error {
+	in := openPath(file, os.Open, os.Stdin)
+	defer in.Close()
+
+	text, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := manager.Render(buf, string(text)); err != nil {
+		return err
+	}
+
+	if output == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	log.Printf("writing %s", output)
+
+	return atomicfile.WriteFile(output, buf.Bytes(), 0600)
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signals are the signals which can be sent by name.
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// kill sends the given signal, by name (e.g. HUP or SIGHUP) or number, to the
+// given process.
+func kill(pid int, sig string) error {
+	s, ok := signals[strings.TrimPrefix(strings.ToUpper(sig), "SIG")]
+	if !ok {
+		n, err := strconv.Atoi(sig)
+		if err != nil {
+			return fmt.Errorf("bad signal: %q", sig)
+		}
+		s = syscall.Signal(n)
+	}
+	return syscall.Kill(pid, s)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "errors"
+
+// kill fails, since Windows doesn't have signals.
+func kill(pid int, sig string) error {
+	return errors.New("signals are unsupported on Windows")
+}
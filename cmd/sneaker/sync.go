@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/codahale/sneaker"
+)
+
+// syncSecrets pushes a directory to a prefix or pulls a prefix into a
+// directory, printing the changes made and a summary.
+func syncSecrets(manager *sneaker.Manager, args map[string]interface{}) {
+	dir, prefix := args["<dir>"].(string), args["<prefix>"].(string)
+	opts := sneaker.SyncOptions{
+		Delete: args["--delete"] == true,
+		DryRun: args["--dry-run"] == true,
+	}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	var (
+		changes []sneaker.SyncChange
+		err     error
+	)
+	if args["push"] == true {
+		changes, err = manager.PushContext(ctx, dir, prefix, opts)
+	} else {
+		changes, err = manager.PullContext(ctx, prefix, dir, opts)
+	}
+
+	counts := map[sneaker.SyncAction]int{}
+	for _, c := range changes {
+		fmt.Printf("%s %s\n", c.Action, c.Path)
+		counts[c.Action]++
+	}
+
+	summary := fmt.Sprintf("%d created, %d updated, %d deleted",
+		counts[sneaker.SyncCreate], counts[sneaker.SyncUpdate], counts[sneaker.SyncDelete])
+	if opts.DryRun {
+		summary = "dry run: would have " + summary
+	}
+	log.Print(summary)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
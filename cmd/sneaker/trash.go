@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codahale/sneaker"
+)
+
+// trash lists or purges the secrets in the trash.
+func trash(manager *sneaker.Manager, args map[string]interface{}) {
+	if args["purge"] == true {
+		age, err := parseAge(args["--older-than"].(string))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		purged, err := manager.PurgeTrash(time.Now().Add(-age))
+		for _, f := range purged {
+			log.Printf("purging %s, deleted %s", f.Path, f.DeletedAt.Format(time.RFC3339))
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	files, err := manager.Trash()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	table := new(tabwriter.Writer)
+	table.Init(os.Stdout, 2, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "key\tdeleted\tdeleted by\tsize\tetag")
+	for _, f := range files {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%v\t%s\n",
+			f.Path,
+			f.DeletedAt.Format(time.RFC3339),
+			f.DeletedBy,
+			f.Size,
+			f.ETag,
+		)
+	}
+	_ = table.Flush()
+}
+
+// parseAge parses a duration, which may also be a whole number of days (e.g.
+// 30d).
+func parseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age: %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codahale/sneaker"
+)
+
+// unpackInto extracts the secrets in the given pack into the given directory,
+// with the owner, mode, and pruning given in args.
+func unpackInto(manager *sneaker.Manager, file, dir string, context map[string]string, args map[string]interface{}) error {
+	mode, err := strconv.ParseUint(args["--mode"].(string), 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return fmt.Errorf("bad mode: %q", args["--mode"])
+	}
+
+	opts := sneaker.ExtractOptions{
+		Mode:  os.FileMode(mode),
+		Prune: args["--prune"] == true,
+	}
+
+	if s, ok := args["--only"].(string); ok {
+		opts.Only = s
+	}
+
+	if s, ok := args["--owner"].(string); ok {
+		if opts.UID, opts.GID, err = parseOwner(s); err != nil {
+			return err
+		}
+		opts.Chown = true
+	}
+
+	// read from file or STDIN
+	in := openPath(file, os.Open, os.Stdin)
+	defer in.Close()
+
+	paths, err := manager.Extract(context, in, dir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		log.Printf("extracted %s", p)
+	}
+	return nil
+}
+
+// unpackList prints the secrets in the given pack's manifest in the given
+// format.
+func unpackList(manager *sneaker.Manager, file string, context map[string]string, format string) error {
+	// read from file or STDIN
+	in := openPath(file, os.Open, os.Stdin)
+	defer in.Close()
+
+	manifest, err := manager.ReadManifest(context, in)
+	if err != nil {
+		return err
+	}
+
+	if manifest.PackedAt.IsZero() {
+		log.Printf("%s has no manifest; digests are unavailable", file)
+	} else {
+		log.Printf("packed at %s with %s", manifest.PackedAt.Format(time.RFC3339), manifest.KeyID)
+	}
+
+	out, err := newOutput(os.Stdout, format, entryRecord{})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range manifest.Entries {
+		if err := out.write(entryRecord{
+			Path:   e.Path,
+			Size:   e.Size,
+			SHA256: e.SHA256,
+			ETag:   e.ETag,
+		}); err != nil {
+			return err
+		}
+	}
+	return out.close()
+}
+
+// parseOwner returns the user and group IDs of the given user and group, given
+// as user:group, or for a user's primary group, just user. Both may be names or
+// numeric IDs.
+func parseOwner(s string) (int, int, error) {
+	name, group := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, group = s[:i], s[i+1:]
+	}
+
+	uid, err := strconv.Atoi(name)
+	gid := -1
+	if err != nil {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("bad owner: %q", s)
+		}
+
+		if gid, err = strconv.Atoi(u.Gid); err != nil {
+			return 0, 0, fmt.Errorf("bad owner: %q", s)
+		}
+	}
+
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, fmt.Errorf("bad owner: %q", s)
+			}
+		}
+	}
+
+	if gid < 0 {
+		return 0, 0, fmt.Errorf("bad owner: %q (give a group as user:group)", s)
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codahale/sneaker"
+)
+
+// watch keeps the given directory in sync with the secrets matching the given
+// pattern until interrupted, running the hooks given in args after each change.
+func watch(manager *sneaker.Manager, pattern, dir string, args map[string]interface{}) {
+	interval, err := time.ParseDuration(args["--interval"].(string))
+	if err != nil || interval <= 0 {
+		log.Fatalf("bad interval: %q", args["--interval"])
+	}
+
+	command, _ := args["--exec-on-change"].(string)
+	pid, _ := args["--pid"].(string)
+	sig := args["--signal"].(string)
+
+	ctx, cancel := terminable()
+	defer cancel()
+
+	w := &sneaker.Watcher{
+		Manager:  manager,
+		Pattern:  pattern,
+		Dir:      dir,
+		Interval: interval,
+	}
+
+	log.Printf("watching %s every %s", pattern, interval)
+	if err := w.Watch(ctx, func(changes *sneaker.WatchChanges, err error) {
+		if err != nil {
+			log.Printf("error syncing: %s", err)
+		}
+
+		if changes == nil || !changes.Changed() {
+			return
+		}
+
+		for _, p := range changes.Written {
+			log.Printf("wrote %s", p)
+		}
+
+		for _, p := range changes.Removed {
+			log.Printf("removed %s", p)
+		}
+
+		if command != "" {
+			log.Printf("running %s", command)
+			cmd := exec.Command("/bin/sh", "-c", command)
+			cmd.Stdout = os.Stderr
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				log.Printf("error running %s: %s", command, err)
+			}
+		}
+
+		if pid != "" {
+			if err := signalPID(pid, sig); err != nil {
+				log.Printf("error sending %s to %s: %s", sig, pid, err)
+			}
+		}
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// signalPID sends the given signal to the process with the given ID, or whose
+// ID is in the given file. The file is read each time, in case the process has
+// been restarted.
+func signalPID(pid, sig string) error {
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		b, err := ioutil.ReadFile(pid)
+		if err != nil {
+			return err
+		}
+
+		if n, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			return fmt.Errorf("bad PID file: %s", pid)
+		}
+	}
+
+	log.Printf("sending %s to %d", sig, n)
+	return kill(n, sig)
+}
@@ -0,0 +1,181 @@
+package sneaker
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// requestObjectStorage is implemented by the S3 client, which can make
+// requests which are cancelled along with their contexts. Other ObjectStorage
+// implementations only have their contexts checked before each request.
+type requestObjectStorage interface {
+	ListObjectsRequest(*s3.ListObjectsInput) (*request.Request, *s3.ListObjectsOutput)
+	DeleteObjectRequest(*s3.DeleteObjectInput) (*request.Request, *s3.DeleteObjectOutput)
+	PutObjectRequest(*s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput)
+	GetObjectRequest(*s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+	HeadObjectRequest(*s3.HeadObjectInput) (*request.Request, *s3.HeadObjectOutput)
+	ListObjectVersionsRequest(*s3.ListObjectVersionsInput) (*request.Request, *s3.ListObjectVersionsOutput)
+}
+
+// requestKeyManagement is the KeyManagement equivalent of requestObjectStorage.
+type requestKeyManagement interface {
+	GenerateDataKeyRequest(*kms.GenerateDataKeyInput) (*request.Request, *kms.GenerateDataKeyOutput)
+	DecryptRequest(*kms.DecryptInput) (*request.Request, *kms.DecryptOutput)
+}
+
+// conditionalObjectStorage is implemented by ObjectStorage implementations
+// which can atomically replace objects only if they haven't changed, such as
+// FileStorage.
+type conditionalObjectStorage interface {
+	PutObjectIfMatch(req *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error)
+}
+
+func (m *Manager) listObjects(ctx context.Context, req *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.ListObjectsRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.ListObjects(req)
+}
+
+func (m *Manager) deleteObject(ctx context.Context, req *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.DeleteObjectRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.DeleteObject(req)
+}
+
+func (m *Manager) putObject(ctx context.Context, req *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.PutObjectRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.PutObject(req)
+}
+
+func (m *Manager) getObject(ctx context.Context, req *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.GetObjectRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.GetObject(req)
+}
+
+func (m *Manager) headObject(ctx context.Context, req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.HeadObjectRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.HeadObject(req)
+}
+
+func (m *Manager) listObjectVersions(ctx context.Context, req *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	if c, ok := m.Objects.(requestObjectStorage); ok {
+		r, resp := c.ListObjectVersionsRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.Objects.ListObjectVersions(req)
+}
+
+func (e *Envelope) generateDataKey(ctx context.Context, req *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	if c, ok := e.KMS.(requestKeyManagement); ok {
+		r, resp := c.GenerateDataKeyRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.KMS.GenerateDataKey(req)
+}
+
+func (e *Envelope) decrypt(ctx context.Context, req *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if c, ok := e.KMS.(requestKeyManagement); ok {
+		r, resp := c.DecryptRequest(req)
+		return resp, send(ctx, r)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.KMS.Decrypt(req)
+}
+
+// send sends the given request, cancelling it (including any retries) if ctx
+// is done. If the request fails because ctx is done, ctx's error is returned.
+func send(ctx context.Context, r *request.Request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.HTTPRequest.Cancel = ctx.Done()
+	if err := r.Send(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// contextReader is a reader which stops returning data once its context is
+// done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// putObjectIfMatch is like putObject, but fails with ErrModified unless the
+// object it replaces has the given ETag, or if the ETag is blank, unless there
+// is no object to replace. That's atomic if the storage supports it; otherwise,
+// the ETag is checked immediately before the object is stored.
+func (m *Manager) putObjectIfMatch(ctx context.Context, req *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	if c, ok := m.Objects.(conditionalObjectStorage); ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return c.PutObjectIfMatch(req, etag)
+	}
+
+	if err := m.checkETag(ctx, aws.StringValue(req.Key), etag); err != nil {
+		return nil, err
+	}
+	return m.putObject(ctx, req)
+}
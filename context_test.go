@@ -0,0 +1,151 @@
+package sneaker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRotateContextCancelled(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets/"
+
+	for i := 0; i < 5; i++ {
+		path := fmt.Sprintf("secret%d.txt", i)
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var rotated []string
+	err = man.RotateContext(ctx, "", func(path string) {
+		rotated = append(rotated, path)
+		if len(rotated) == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("Error was %v, but expected %v", err, context.Canceled)
+	}
+
+	if v, want := strings.Join(rotated, ","), "secret0.txt,secret1.txt"; v != want {
+		t.Errorf("Rotated %v, but expected %v", v, want)
+	}
+
+	after, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first secret was rotated, and the second was cancelled in progress
+	for i := range after {
+		if v, want := before[i].ETag != after[i].ETag, i == 0; v != want {
+			t.Errorf("%s re-encrypted was %v, but expected %v", after[i].Path, v, want)
+		}
+	}
+}
+
+func TestContextCancelledBeforeRequests(t *testing.T) {
+	fakeS3 := &FakeS3{}
+	fakeKMS := &FakeKMS{}
+	man := Manager{
+		Objects: fakeS3,
+		Envelope: Envelope{
+			KMS: fakeKMS,
+		},
+		KeyId:  "key1",
+		Bucket: "bucket",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := man.ListContext(ctx, ""); err != context.Canceled {
+		t.Errorf("ListContext returned %v", err)
+	}
+
+	if err := man.UploadContext(ctx, "secret", strings.NewReader("secret")); err != context.Canceled {
+		t.Errorf("UploadContext returned %v", err)
+	}
+
+	if _, err := man.DownloadContext(ctx, []string{"secret"}); err != context.Canceled {
+		t.Errorf("DownloadContext returned %v", err)
+	}
+
+	if err := man.RmContext(ctx, "secret"); err != context.Canceled {
+		t.Errorf("RmContext returned %v", err)
+	}
+
+	if _, err := man.Envelope.SealContext(ctx, "key1", nil, []byte("secret")); err != context.Canceled {
+		t.Errorf("SealContext returned %v", err)
+	}
+
+	if n := len(fakeS3.ListInputs) + len(fakeS3.PutInputs) + len(fakeS3.GetInputs) + len(fakeS3.DeleteInputs); n != 0 {
+		t.Errorf("Made %d S3 requests, but expected none", n)
+	}
+
+	if n := len(fakeKMS.GenerateInputs); n != 0 {
+		t.Errorf("Made %d KMS requests, but expected none", n)
+	}
+}
+
+func TestContextCancelsRequests(t *testing.T) {
+	// a server which never responds
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	sess := session.New(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+
+	man := Manager{
+		Objects: s3.New(sess),
+		Envelope: Envelope{
+			KMS: kms.New(sess),
+		},
+		KeyId:  "key1",
+		Bucket: "bucket",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := man.DownloadToContext(ctx, "secret", ioutil.Discard); err != context.DeadlineExceeded {
+		t.Errorf("DownloadToContext returned %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := man.Envelope.SealContext(ctx, "key1", nil, []byte("secret")); err != context.DeadlineExceeded {
+		t.Errorf("SealContext returned %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package sneaker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DiffOptions control how Diff reports differences.
+type DiffOptions struct {
+	// Redact is whether to report only where the plaintexts differ, not what
+	// they contain. JSON objects and dotenv secrets are compared by key, and
+	// the keys which were added, removed, or changed are reported. Other
+	// plaintexts are compared by line, and only the hunk headers, which give
+	// the numbers of the lines which changed, are reported.
+	Redact bool
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells is the largest table of lines Diff compares line by line. Past
+// that, the lines between the common prefix and suffix are reported as
+// replaced wholesale.
+const maxDiffCells = 1 << 22
+
+// Diff writes a unified diff of the plaintexts of the given secrets to w,
+// labelled with their paths, and returns whether they differ. Nothing is
+// written if they're the same.
+func Diff(w io.Writer, a, b Secret, opts DiffOptions) (bool, error) {
+	if a.Value == b.Value {
+		return false, nil
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s\n", a.Path, b.Path)
+
+	// if only the formatting of structured secrets changed, fall back to lines
+	if opts.Redact {
+		if ka, kb, ok := structured(a.Value, b.Value); ok && diffKeys(bw, ka, kb) > 0 {
+			return true, bw.Flush()
+		}
+	}
+
+	context := diffContext
+	if opts.Redact {
+		context = 0
+	}
+
+	al, bl := splitLines(a.Value), splitLines(b.Value)
+	for _, h := range hunks(diffLines(al, bl), context) {
+		fmt.Fprintf(bw, "@@ -%s +%s @@\n", h.a, h.b)
+		if opts.Redact {
+			continue
+		}
+
+		for _, e := range h.edits {
+			fmt.Fprintf(bw, "%c%s", e.op, e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				fmt.Fprint(bw, "\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return true, bw.Flush()
+}
+
+// structured returns the keys and values of both plaintexts, if both are JSON
+// objects, or both are dotenv secrets with at least two variables, so a secret
+// which merely contains an = (e.g. base64) isn't mistaken for one. Nested
+// JSON objects' keys are joined with dots (e.g. db.password).
+func structured(a, b string) (map[string]string, map[string]string, bool) {
+	for _, parse := range []func(string) (map[string]string, bool){jsonKeys, dotenvKeys} {
+		ka, okA := parse(a)
+		kb, okB := parse(b)
+		if okA && okB {
+			return ka, kb, true
+		}
+	}
+	return nil, nil, false
+}
+
+// jsonKeys flattens the given JSON object.
+func jsonKeys(s string) (map[string]string, bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &obj); err != nil || obj == nil {
+		return nil, false
+	}
+
+	keys := map[string]string{}
+	var flatten func(string, map[string]json.RawMessage)
+	flatten = func(prefix string, obj map[string]json.RawMessage) {
+		for k, v := range obj {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(v, &nested); err == nil && nested != nil {
+				flatten(prefix+k+".", nested)
+				continue
+			}
+			keys[prefix+k] = compactJSON(v)
+		}
+	}
+	flatten("", obj)
+	return keys, true
+}
+
+// compactJSON returns the given JSON value without insignificant whitespace,
+// so values are compared by what they are, not how they're formatted.
+func compactJSON(v json.RawMessage) string {
+	var x interface{}
+	if err := json.Unmarshal(v, &x); err != nil {
+		return string(v)
+	}
+
+	b, err := json.Marshal(x)
+	if err != nil {
+		return string(v)
+	}
+	return string(b)
+}
+
+// dotenvKeys parses the given dotenv secret.
+func dotenvKeys(s string) (map[string]string, bool) {
+	vars, err := ParseDotenv([]byte(s))
+	if err != nil || len(vars) < 2 {
+		return nil, false
+	}
+	return vars, true
+}
+
+// diffKeys writes the keys which were added (+), removed (-), or changed (~),
+// sorted, and returns how many there were.
+func diffKeys(w io.Writer, a, b map[string]string) int {
+	all := map[string]bool{}
+	for k := range a {
+		all[k] = true
+	}
+	for k := range b {
+		all[k] = true
+	}
+
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var n int
+	for _, k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+
+		var op string
+		switch {
+		case !inA:
+			op = "+"
+		case !inB:
+			op = "-"
+		case va != vb:
+			op = "~"
+		default:
+			continue
+		}
+		fmt.Fprintf(w, "%s %s\n", op, k)
+		n++
+	}
+	return n
+}
+
+// splitLines splits the given text into lines, each with its trailing newline,
+// if any.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+	return lines
+}
+
+// An edit is a line which is kept ( ), removed (-), or added (+).
+type edit struct {
+	op   byte
+	line string
+}
+
+// diffLines returns the edits which turn a into b, using the longest common
+// subsequence of their lines.
+func diffLines(a, b []string) []edit {
+	// trim the common prefix and suffix, which are usually most of the lines
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		edits = append(edits, edit{' ', l})
+	}
+
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if (len(ma)+1)*(len(mb)+1) > maxDiffCells {
+		for _, l := range ma {
+			edits = append(edits, edit{'-', l})
+		}
+		for _, l := range mb {
+			edits = append(edits, edit{'+', l})
+		}
+	} else {
+		edits = append(edits, lcs(ma, mb)...)
+	}
+
+	for _, l := range a[len(a)-suf:] {
+		edits = append(edits, edit{' ', l})
+	}
+	return edits
+}
+
+// lcs returns the edits which turn a into b, keeping the longest common
+// subsequence of their lines. Removals come before additions.
+func lcs(a, b []string) []edit {
+	// n[i][j] is the length of the LCS of a[i:] and b[j:]
+	n := make([][]int32, len(a)+1)
+	for i := range n {
+		n[i] = make([]int32, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				n[i][j] = n[i+1][j+1] + 1
+			case n[i+1][j] >= n[i][j+1]:
+				n[i][j] = n[i+1][j]
+			default:
+				n[i][j] = n[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || n[i+1][j] >= n[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
+
+// A hunk is a run of edits, with the ranges of lines they cover in each side.
+type hunk struct {
+	a, b  string
+	edits []edit
+}
+
+// hunks groups the given edits into hunks, each with up to context unchanged
+// lines around its changes. Changes separated by no more than twice that are
+// in the same hunk.
+func hunks(edits []edit, context int) []hunk {
+	var (
+		hs         []hunk
+		start, end = -1, -1
+	)
+
+	flush := func() {
+		if start < 0 {
+			return
+		}
+
+		from, to := start-context, end+context
+		if from < 0 {
+			from = 0
+		}
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		// the line numbers before the hunk
+		var na, nb int
+		for _, e := range edits[:from] {
+			if e.op != '+' {
+				na++
+			}
+			if e.op != '-' {
+				nb++
+			}
+		}
+
+		var ca, cb int
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				ca++
+			}
+			if e.op != '-' {
+				cb++
+			}
+		}
+
+		hs = append(hs, hunk{a: hunkRange(na, ca), b: hunkRange(nb, cb), edits: edits[from:to]})
+	}
+
+	for i, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+
+		if start >= 0 && i-end > 2*context {
+			flush()
+			start = -1
+		}
+
+		if start < 0 {
+			start = i
+		}
+		end = i + 1
+	}
+	flush()
+	return hs
+}
+
+// hunkRange formats the range of lines in one side of a hunk, given the number
+// of lines before it and in it.
+func hunkRange(before, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, n)
+	}
+}
@@ -0,0 +1,126 @@
+package sneaker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := Secret{Path: "config", Value: "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"}
+	b := Secret{Path: "config.new", Value: "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven"}
+
+	buf := bytes.NewBuffer(nil)
+	changed, err := Diff(buf, a, b, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changed {
+		t.Error("Diff reported no changes")
+	}
+
+	want := `--- config
++++ config.new
+@@ -1,5 +1,5 @@
+ one
+-two
++2
+ three
+ four
+ five
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+\ No newline at end of file
+`
+	if v := buf.String(); v != want {
+		t.Errorf("Diff was\n%s\nbut expected\n%s", v, want)
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	changed, err := Diff(buf, Secret{Path: "a", Value: "same"}, Secret{Path: "b", Value: "same"}, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed {
+		t.Error("Diff reported changes")
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Diff wrote %q", buf)
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	if _, err := Diff(buf, Secret{Path: "a"}, Secret{Path: "b", Value: "new\n"}, DiffOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := buf.String(), "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n"; v != want {
+		t.Errorf("Diff was %q, but expected %q", v, want)
+	}
+}
+
+func TestDiffRedact(t *testing.T) {
+	for _, tc := range []struct {
+		name, a, b, want string
+	}{
+		{
+			name: "json",
+			a:    `{"user": "app", "password": "hunter2", "db": {"host": "a", "port": 5432}, "old": true}`,
+			b:    `{"user": "app", "password": "hunter3", "db": {"host": "a", "port": 5433}, "new": [1, 2]}`,
+			want: "~ db.port\n+ new\n- old\n~ password\n",
+		},
+		{
+			name: "dotenv",
+			a:    "USER=app\nPASSWORD=hunter2\n",
+			b:    "export USER=app\nPASSWORD='hunter3'\nHOST=db\n",
+			want: "+ HOST\n~ PASSWORD\n",
+		},
+		{
+			name: "lines",
+			a:    "hunter2\nsame\nsecret\n",
+			b:    "hunter3\nsame\nsecret\nmore\n",
+			want: "@@ -1 +1 @@\n@@ -3,0 +4 @@\n",
+		},
+		{
+			name: "base64",
+			a:    "aHVudGVyMg==\n",
+			b:    "aHVudGVyMw==\n",
+			want: "@@ -1 +1 @@\n",
+		},
+		{
+			name: "formatting",
+			a:    "{\"password\": \"hunter2\"}\n",
+			b:    "{\n  \"password\": \"hunter2\"\n}\n",
+			want: "@@ -1 +1,3 @@\n",
+		},
+	} {
+		buf := bytes.NewBuffer(nil)
+		changed, err := Diff(buf, Secret{Path: "a", Value: tc.a}, Secret{Path: "b", Value: tc.b}, DiffOptions{Redact: true})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+
+		if !changed {
+			t.Errorf("%s: Diff reported no changes", tc.name)
+		}
+
+		if v, want := buf.String(), "--- a\n+++ b\n"+tc.want; v != want {
+			t.Errorf("%s: Diff was %q, but expected %q", tc.name, v, want)
+		}
+
+		for _, s := range []string{"hunter", "aHVudGVy"} {
+			if strings.Contains(buf.String(), s) {
+				t.Errorf("%s: Diff revealed %q", tc.name, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	fpath "path"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Unchanged returns whether the given secret exists and has the given
+// plaintext. It compares the secret's digest with the plaintext's, so the
+// secret isn't downloaded or decrypted. Secrets without digests are never
+// unchanged.
+func (m *Manager) Unchanged(path string, plaintext []byte) (bool, error) {
+	return m.UnchangedContext(context.Background(), path, plaintext)
+}
+
+// UnchangedContext is like Unchanged, but stops if ctx is done.
+func (m *Manager) UnchangedContext(ctx context.Context, path string, plaintext []byte) (bool, error) {
+	s, err := m.stat(ctx, fpath.Join(m.Prefix, path), "")
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if s.digest == "" {
+		return false, nil
+	}
+
+	// a comparison never creates the digest key, so it can be made by those
+	// who can only read secrets
+	key, err := m.digestKey(ctx, false)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to use digest key: %s", err)
+	}
+
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write(plaintext)
+	return hmac.Equal([]byte(s.digest), []byte(sha256Hex(h))), nil
+}
+
+// digestKeyPath is where the key used to digest plaintexts is stored,
+// encrypted with KMS.
+const digestKeyPath = metaDir + "/digest-key"
+
+// newDigest returns a hash which computes the digests recorded with secrets:
+// an HMAC-SHA256 of the plaintext. The key is generated with KMS the first
+// time it's needed, stored encrypted with the KMS key, and shared by every
+// secret, so equal plaintexts have equal digests, but the digests reveal
+// nothing about the plaintexts to those who can't decrypt the key.
+func (m *Manager) newDigest(ctx context.Context) (hash.Hash, error) {
+	key, err := m.digestKey(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to use digest key: %s", err)
+	}
+	return hmac.New(sha256.New, key), nil
+}
+
+// digestKey returns the digest key of m.Bucket and m.Prefix, fetching it the
+// first time it's needed, and if create is true and there isn't one, creating
+// it.
+func (m *Manager) digestKey(ctx context.Context, create bool) ([]byte, error) {
+	c := m.digestKeys()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := digestKeyID{bucket: m.Bucket, prefix: m.Prefix}
+	if key, ok := c.keys[id]; ok {
+		return key, nil
+	}
+
+	key, err := m.loadDigestKey(ctx)
+	if IsNotFound(err) && create {
+		key, err = m.createDigestKey(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.keys[id] = key
+	return key, nil
+}
+
+// A digestKeyCache holds the digest keys a Manager has fetched. Managers which
+// are copies of one another share it, so it's keyed by where each key is
+// stored.
+type digestKeyCache struct {
+	mu   sync.Mutex
+	keys map[digestKeyID][]byte
+}
+
+// A digestKeyID identifies a digest key by the bucket and prefix it's stored
+// in.
+type digestKeyID struct {
+	bucket, prefix string
+}
+
+// digestKeys returns m's digest key cache, creating it the first time it's
+// needed.
+func (m *Manager) digestKeys() *digestKeyCache {
+	if c, ok := m.digestCache.Load().(*digestKeyCache); ok {
+		return c
+	}
+
+	c := &digestKeyCache{keys: map[digestKeyID][]byte{}}
+	if m.digestCache.CompareAndSwap(nil, c) {
+		return c
+	}
+	return m.digestCache.Load().(*digestKeyCache)
+}
+
+// loadDigestKey fetches and decrypts the digest key.
+func (m *Manager) loadDigestKey(ctx context.Context) ([]byte, error) {
+	blob, err := m.readDigestKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _, err := m.Envelope.decryptKey(ctx, m.digestContext(), blob)
+	return key, err
+}
+
+// readDigestKey fetches the encrypted digest key.
+func (m *Manager) readDigestKey(ctx context.Context) ([]byte, error) {
+	resp, err := m.getObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(fpath.Join(m.Prefix, digestKeyPath)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxHeaderPeek))
+}
+
+// createDigestKey generates a new digest key and stores it, unless another
+// process has already done so, in which case that key is used. Storage which
+// can't store it atomically (i.e. S3) may let two processes store one at once,
+// so the stored key is read back, and both use the one which was stored last.
+func (m *Manager) createDigestKey(ctx context.Context) ([]byte, error) {
+	key, err := m.Envelope.generateDataKey(ctx, &kms.GenerateDataKeyInput{
+		EncryptionContext: m.Envelope.context(m.digestContext()),
+		KeySpec:           aws.String("AES_256"),
+		KeyId:             aws.String(m.KeyId),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.putObjectIfMatch(ctx, &s3.PutObjectInput{
+		ContentLength: aws.Int64(int64(len(key.CiphertextBlob))),
+		ContentType:   aws.String(contentType),
+		Bucket:        aws.String(m.Bucket),
+		Key:           aws.String(fpath.Join(m.Prefix, digestKeyPath)),
+		Body:          bytes.NewReader(key.CiphertextBlob),
+	}, ""); err != nil {
+		zero(key.Plaintext)
+		if err == ErrModified {
+			return m.loadDigestKey(ctx)
+		}
+		return nil, err
+	}
+
+	blob, err := m.readDigestKey(ctx)
+	if err != nil {
+		zero(key.Plaintext)
+		return nil, err
+	}
+
+	if !bytes.Equal(blob, key.CiphertextBlob) {
+		// another process stored a key after this one
+		zero(key.Plaintext)
+		k, _, err := m.Envelope.decryptKey(ctx, m.digestContext(), blob)
+		return k, err
+	}
+	return key.Plaintext, nil
+}
+
+// digestContext returns the encryption context of the digest key. It's only
+// the key's path, not m.EncryptionContext, so the key is shared by secrets
+// encrypted with any context.
+func (m *Manager) digestContext() map[string]string {
+	return map[string]string{
+		"Path": fmt.Sprintf("s3://%s/%s", m.Bucket, fpath.Join(m.Prefix, digestKeyPath)),
+	}
+}
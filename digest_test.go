@@ -0,0 +1,189 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnchanged(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.EncryptionContext = map[string]string{"A": "B"}
+	man.Prefix = "secrets"
+	root := man.Objects.(*FileStorage).Root
+
+	if err := man.Upload("weeble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "bucket", "secrets", digestKeyPath)); err != nil {
+		t.Errorf("Digest key wasn't stored: %v", err)
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Fatalf("Listed %d files, but expected %d", v, want)
+	}
+
+	if files[0].Digest == "" {
+		t.Error("File had no digest")
+	}
+
+	for _, tc := range []struct {
+		path, plaintext string
+		unchanged       bool
+	}{
+		{"weeble.txt", "this is a test", true},
+		{"weeble.txt", "this is another test", false},
+		{"wobble.txt", "this is a test", false},
+	} {
+		ok, err := man.Unchanged(tc.path, []byte(tc.plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != tc.unchanged {
+			t.Errorf("Unchanged(%q, %q) was %v, but expected %v", tc.path, tc.plaintext, ok, tc.unchanged)
+		}
+	}
+
+	// another manager, with another context, uses the same key
+	other := &Manager{
+		Objects:  man.Objects,
+		Envelope: man.Envelope,
+		KeyId:    "key1",
+		Bucket:   "bucket",
+		Prefix:   "secrets",
+	}
+
+	if err := other.Upload("wobble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = other.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 2; v != want {
+		t.Fatalf("Listed %d files, but expected %d", v, want)
+	}
+
+	if files[0].Digest != files[1].Digest {
+		t.Errorf("Digests were %q and %q, but expected them to be equal", files[0].Digest, files[1].Digest)
+	}
+}
+
+func TestUploadWithoutDigestKey(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets"
+
+	// a digest key which can't be decrypted
+	name := filepath.Join(man.Objects.(*FileStorage).Root, "bucket", "secrets", digestKeyPath)
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("bogus"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Upload("weeble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Fatalf("Listed %d files, but expected %d", v, want)
+	}
+
+	if v := files[0].Digest; v != "" {
+		t.Errorf("Digest was %q, but expected none", v)
+	}
+
+	unchanged, err := man.Unchanged("weeble.txt", []byte("this is a test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unchanged {
+		t.Error("Secret without a digest was unchanged")
+	}
+}
+
+func TestUnchangedDoesNotCreateDigestKey(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets"
+
+	unchanged, err := man.Unchanged("weeble.txt", []byte("this is a test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unchanged {
+		t.Error("Missing secret was unchanged")
+	}
+
+	name := filepath.Join(man.Objects.(*FileStorage).Root, "bucket", "secrets", digestKeyPath)
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Digest key was created: %v", err)
+	}
+}
+
+func TestUploadReservedMetaPath(t *testing.T) {
+	man := Manager{}
+	if err := man.Upload(digestKeyPath, strings.NewReader("boo")); err != ErrReservedPath {
+		t.Errorf("Error was %v, but expected %v", err, ErrReservedPath)
+	}
+
+	if err := man.Upload("x/../"+digestKeyPath, strings.NewReader("boo")); err != ErrInvalidPath {
+		t.Errorf("Error was %v, but expected %v", err, ErrInvalidPath)
+	}
+}
+
+func TestDigestKeyPerPrefix(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets"
+
+	if err := man.Upload("weeble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a copy shares the cache, but not the key of another prefix
+	other := *man
+	other.Prefix = "other"
+
+	if err := other.Upload("weeble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []string{"secrets", "other"} {
+		name := filepath.Join(man.Objects.(*FileStorage).Root, "bucket", prefix, digestKeyPath)
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Digest key wasn't stored in %s: %v", prefix, err)
+		}
+	}
+
+	unchanged, err := other.Unchanged("weeble.txt", []byte("this is a test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !unchanged {
+		t.Error("Secret was changed")
+	}
+}
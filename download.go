@@ -1,37 +1,171 @@
 package sneaker
 
 import (
-	"io/ioutil"
+	"bytes"
+	"context"
+	"io"
 	fpath "path"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// Download fetches and decrypts the given secrets.
+// Download fetches and decrypts the given secrets, up to m.Concurrency at a
+// time. If any secrets can't be downloaded, the error is a PathErrors.
 func (m *Manager) Download(paths []string) (map[string][]byte, error) {
+	return m.DownloadContext(context.Background(), paths)
+}
+
+// DownloadContext is like Download, but stops if ctx is done.
+func (m *Manager) DownloadContext(ctx context.Context, paths []string) (map[string][]byte, error) {
+	var mu sync.Mutex
 	secrets := make(map[string][]byte, len(paths))
-	for _, path := range paths {
-		resp, err := m.Objects.GetObject(&s3.GetObjectInput{
-			Bucket: aws.String(m.Bucket),
-			Key:    aws.String(fpath.Join(m.Prefix, path)),
-		})
-		if err != nil {
-			return nil, err
+	if err := m.each(ctx, paths, func(path string) error {
+		buf := bytes.NewBuffer(nil)
+		if err := m.DownloadToContext(ctx, path, buf); err != nil {
+			return err
 		}
-		defer resp.Body.Close()
 
-		ciphertext, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+		mu.Lock()
+		defer mu.Unlock()
+		secrets[path] = buf.Bytes()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// DownloadTo fetches the given secret and writes the plaintext to w as it is
+// decrypted, so secrets of any size can be downloaded in bounded memory. If an
+// error is returned, w may have received some plaintext which must be
+// discarded.
+func (m *Manager) DownloadTo(path string, w io.Writer) error {
+	return m.DownloadToContext(context.Background(), path, w)
+}
+
+// DownloadToContext is like DownloadTo, but stops if ctx is done.
+func (m *Manager) DownloadToContext(ctx context.Context, path string, w io.Writer) error {
+	r, err := m.open(ctx, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// DownloadWithETag fetches and decrypts the given secret, returning it along
+// with the ETag of the encrypted object, for use with UploadIfMatch.
+func (m *Manager) DownloadWithETag(path string) ([]byte, string, error) {
+	return m.DownloadWithETagContext(context.Background(), path)
+}
+
+// DownloadWithETagContext is like DownloadWithETag, but stops if ctx is done.
+func (m *Manager) DownloadWithETagContext(ctx context.Context, path string) ([]byte, string, error) {
+	r, err := m.open(ctx, path, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), r.etag, nil
+}
+
+// ETag returns the ETag of the given secret's encrypted object, as returned by
+// DownloadWithETag, without downloading or decrypting it. It changes whenever
+// the secret is uploaded or rotated.
+func (m *Manager) ETag(path string) (string, error) {
+	return m.ETagContext(context.Background(), path)
+}
+
+// ETagContext is like ETag, but stops if ctx is done.
+func (m *Manager) ETagContext(ctx context.Context, path string) (string, error) {
+	resp, err := m.headObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(fpath.Join(m.Prefix, path)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return unquote(aws.StringValue(resp.ETag)), nil
+}
+
+// A secretReader reads the plaintext of a secret as it is decrypted.
+type secretReader struct {
+	io.Reader
+	io.Closer
+
+	size   int64 // the size of the plaintext, or -1 if unknown
+	etag   string
+	keying keying // what the secret is encrypted with, to re-encrypt it
+}
+
+// open fetches the given version of the secret, or if the version ID is blank,
+// the latest version, and returns a reader of its plaintext. It's decrypted
+// with the encryption context recorded with it, or m.EncryptionContext, plus
+// its path and any extra context.
+func (m *Manager) open(ctx context.Context, path, versionID string, extra map[string]string) (*secretReader, error) {
+	var version *string
+	if versionID != "" {
+		version = aws.String(versionID)
+	}
+
+	resp, err := m.getObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(m.Bucket),
+		Key:       aws.String(fpath.Join(m.Prefix, path)),
+		VersionId: version,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		plaintext, err := m.Envelope.Open(m.context(path), ciphertext)
-		if err != nil {
+	size := int64(-1)
+	if resp.ContentLength != nil {
+		size = *resp.ContentLength
+	}
+
+	k := m.keying()
+	if c := metadata(resp.Metadata, metaContext); c != "" {
+		if k.ctxt, err = decodeContext(c); err != nil {
+			_ = resp.Body.Close()
 			return nil, err
 		}
+	}
 
-		secrets[path] = plaintext
+	ctxt := m.context(k.ctxt, path)
+	for name, value := range extra {
+		ctxt[name] = value
 	}
-	return secrets, nil
+
+	r, h, size, err := m.Envelope.openReader(ctx, ctxt, resp.Body, size)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+
+	if h.KeyID != "" {
+		k.keyID = h.KeyID
+	} else if id := kmsKeyARN(h.DataKey); id != "" {
+		k.keyID = id
+	}
+
+	return &secretReader{
+		Reader: r,
+		Closer: resp.Body,
+		size:   size,
+		etag:   unquote(aws.StringValue(resp.ETag)),
+		keying: k,
+	}, nil
+}
+
+func unquote(etag string) string {
+	return strings.Replace(etag, "\"", "", -1)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -69,3 +70,40 @@ func TestDownload(t *testing.T) {
 		t.Errorf("Key was %q, but expected %q", v, want)
 	}
 }
+
+func TestETag(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("weeble.txt", strings.NewReader("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, expected, err := man.DownloadWithETag("weeble.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag, err := man.ETag("weeble.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := etag, expected; v != want {
+		t.Errorf("ETag was %q, but expected %q", v, want)
+	}
+
+	if err := man.Upload("weeble.txt", strings.NewReader("two")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := man.ETag("weeble.txt"); err != nil {
+		t.Fatal(err)
+	} else if v == etag {
+		t.Errorf("ETag was still %q after an upload", v)
+	}
+
+	if _, err := man.ETag("wobble.txt"); !IsNotFound(err) {
+		t.Errorf("Error was %v, but expected it to be not found", err)
+	}
+}
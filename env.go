@@ -0,0 +1,104 @@
+package sneaker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// EnvName returns the name of the environment variable for a secret with the
+// given path: the path, upper-cased, with every character which isn't a letter
+// or digit replaced with an underscore (e.g. db/password becomes DB_PASSWORD).
+func EnvName(path string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, path)
+
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// ParseDotenv parses a secret in the dotenv format: one NAME=value pair per
+// line, optionally preceded by "export". Blank lines and lines beginning with #
+// are ignored. Values may be single-quoted, which are taken literally, or
+// double-quoted, which may contain \n, \t, \", and \\ escapes.
+func ParseDotenv(b []byte) (map[string]string, error) {
+	vars := map[string]string{}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.IndexByte(line, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+
+		name := strings.TrimSpace(line[:i])
+		value, err := dotenvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		vars[name] = value
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func dotenvValue(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	switch s[0] {
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return s[1 : len(s)-1], nil
+	case '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return "", fmt.Errorf("unterminated quote")
+		}
+
+		var buf bytes.Buffer
+		for i := 1; i < len(s)-1; i++ {
+			c := s[i]
+			if c == '\\' && i < len(s)-2 {
+				i++
+				switch s[i] {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				case 'r':
+					c = '\r'
+				default:
+					c = s[i]
+				}
+			}
+			buf.WriteByte(c)
+		}
+		return buf.String(), nil
+	}
+
+	// unquoted values end at a comment
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
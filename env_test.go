@@ -0,0 +1,63 @@
+package sneaker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	for path, want := range map[string]string{
+		"db/password":    "DB_PASSWORD",
+		"api-key.txt":    "API_KEY_TXT",
+		"2fa/seed":       "_2FA_SEED",
+		"prod/Redis/url": "PROD_REDIS_URL",
+		"café/secret":    "CAF__SECRET",
+	} {
+		if v := EnvName(path); v != want {
+			t.Errorf("Name for %q was %q, but expected %q", path, v, want)
+		}
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	actual, err := ParseDotenv([]byte(`
+# a comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded  # trailing comment
+SINGLE='it''s $literal\n'
+DOUBLE="line one\nline \"two\""
+EMPTY=
+URL=postgres://u:p@host/db?a=b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "yes",
+		"SPACED":   "padded",
+		"SINGLE":   `it''s $literal\n`,
+		"DOUBLE":   "line one\nline \"two\"",
+		"EMPTY":    "",
+		"URL":      "postgres://u:p@host/db?a=b",
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Was %#v, but expected %#v", actual, expected)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for _, s := range []string{
+		"NOEQUALS",
+		"=value",
+		`UNTERMINATED="value`,
+		`UNTERMINATED='value`,
+	} {
+		if _, err := ParseDotenv([]byte(s)); err == nil {
+			t.Errorf("Parsed %q", s)
+		}
+	}
+}
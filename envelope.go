@@ -1,11 +1,16 @@
 package sneaker
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -18,11 +23,41 @@ type Envelope struct {
 	KMS KeyManagement
 }
 
+// A Header describes how a secret was encrypted.
+type Header struct {
+	// Version is the version of the envelope format. Secrets written by older
+	// versions of sneaker have no header and a version of 0.
+	Version int
+
+	// Suite is the cipher suite used to encrypt the secret.
+	Suite int
+
+	// KeyID is the ID of the KMS key used to encrypt the data key, as reported
+	// by KMS when the secret was encrypted. It is blank for version 0 secrets.
+	KeyID string
+
+	// DataKey is the encrypted KMS data key.
+	DataKey []byte
+
+	raw []byte
+}
+
+// ReadHeader reads the header of the given ciphertext, without decrypting it.
+func ReadHeader(r io.Reader) (*Header, error) {
+	return readHeader(bufio.NewReader(r))
+}
+
 // Seal generates a 256-bit data key using KMS and encrypts the given plaintext
 // with AES-256-GCM using a random nonce. The ciphertext is appended to the
-// nonce, which is in turn appended to the KMS data key ciphertext and returned.
+// nonce, which is in turn appended to a header containing the KMS data key
+// ciphertext, and returned.
 func (e *Envelope) Seal(keyID string, ctxt map[string]string, plaintext []byte) ([]byte, error) {
-	key, err := e.KMS.GenerateDataKey(&kms.GenerateDataKeyInput{
+	return e.SealContext(context.Background(), keyID, ctxt, plaintext)
+}
+
+// SealContext is like Seal, but the KMS request is cancelled if ctx is done.
+func (e *Envelope) SealContext(ctx context.Context, keyID string, ctxt map[string]string, plaintext []byte) ([]byte, error) {
+	key, err := e.generateDataKey(ctx, &kms.GenerateDataKeyInput{
 		EncryptionContext: e.context(ctxt),
 		KeySpec:           aws.String("AES_256"),
 		KeyId:             &keyID,
@@ -31,34 +66,71 @@ func (e *Envelope) Seal(keyID string, ctxt map[string]string, plaintext []byte)
 		return nil, err
 	}
 
-	ciphertext, err := encrypt(key.Plaintext, plaintext, []byte(*key.KeyId))
+	header, err := newHeader(SuiteGCM, *key.KeyId, key.CiphertextBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := encrypt(key.Plaintext, plaintext, header.data())
 	if err != nil {
 		return nil, err
 	}
 
-	return join(key.CiphertextBlob, ciphertext), nil
+	return append(header.raw, ciphertext...), nil
 }
 
-// Open takes the output of Seal and decrypts it. If any part of the ciphertext
-// or context is modified, Seal will return an error instead of the decrypted
-// data.
+// Open takes the output of Seal (or SealWriter) and decrypts it. If any part of
+// the ciphertext or context is modified, Seal will return an error instead of
+// the decrypted data. If the ciphertext is malformed, the error will be a
+// *FormatError.
 func (e *Envelope) Open(ctxt map[string]string, ciphertext []byte) ([]byte, error) {
-	key, ciphertext := split(ciphertext)
+	return e.OpenContext(context.Background(), ctxt, ciphertext)
+}
+
+// OpenContext is like Open, but the KMS request is cancelled if ctx is done.
+func (e *Envelope) OpenContext(ctx context.Context, ctxt map[string]string, ciphertext []byte) ([]byte, error) {
+	r, _, _, err := e.openReader(ctx, ctxt, bytes.NewReader(ciphertext), -1)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// open decrypts the payload which follows the given header.
+func (e *Envelope) open(ctx context.Context, ctxt map[string]string, h *Header, payload []byte) ([]byte, error) {
+	key, keyID, err := e.decryptKey(ctx, ctxt, h.DataKey)
+	if err != nil {
+		return nil, err
+	}
 
-	d, err := e.KMS.Decrypt(&kms.DecryptInput{
+	if h.Version == 0 {
+		return decrypt(key, payload, []byte(keyID))
+	}
+
+	if h.KeyID != keyID {
+		zero(key)
+		return nil, &FormatError{fmt.Sprintf("header key ID %q does not match %q", h.KeyID, keyID)}
+	}
+
+	return decrypt(key, payload, h.data())
+}
+
+// decryptKey uses KMS to decrypt the given data key, returning the plaintext
+// key and the ID of the KMS key which was used.
+func (e *Envelope) decryptKey(ctx context.Context, ctxt map[string]string, key []byte) ([]byte, string, error) {
+	d, err := e.decrypt(ctx, &kms.DecryptInput{
 		CiphertextBlob:    key,
 		EncryptionContext: e.context(ctxt),
 	})
 	if err != nil {
 		if apiErr, ok := err.(awserr.Error); ok {
 			if apiErr.Code() == "InvalidCiphertextException" {
-				return nil, fmt.Errorf("unable to decrypt data key")
+				return nil, "", fmt.Errorf("unable to decrypt data key")
 			}
 		}
-		return nil, err
+		return nil, "", err
 	}
-
-	return decrypt(d.Plaintext, ciphertext, []byte(*d.KeyId))
+	return d.Plaintext, *d.KeyId, nil
 }
 
 func (e *Envelope) context(c map[string]string) map[string]*string {
@@ -69,33 +141,162 @@ func (e *Envelope) context(c map[string]string) map[string]*string {
 	return ctxt
 }
 
-func decrypt(key, ciphertext, data []byte) ([]byte, error) {
-	defer zero(key)
+// A FormatError is returned when a ciphertext is malformed or truncated.
+type FormatError struct {
+	Reason string
+}
 
-	block, err := aes.NewCipher(key)
+func (e *FormatError) Error() string {
+	return "malformed ciphertext: " + e.Reason
+}
+
+// The cipher suites used to encrypt secrets.
+const (
+	// SuiteGCM is AES-256-GCM with a random nonce.
+	SuiteGCM = 1
+
+	// SuiteGCMStream is AES-256-GCM in the STREAM construction, with 64KiB
+	// chunks.
+	SuiteGCMStream = 2
+)
+
+// newHeader returns a version 1 header. Its encoding is the following:
+//
+//	magic    4 bytes, "SNKR"
+//	version  1 byte
+//	suite    1 byte
+//	key ID   2 bytes of length, in network order, then the key ID
+//	data key 4 bytes of length, in network order, then the encrypted data key
+//
+// The entire header is authenticated along with the payload.
+func newHeader(suite int, keyID string, dataKey []byte) (*Header, error) {
+	if len(keyID) > 0xffff || len(dataKey) > maxKeyBlobSize {
+		return nil, fmt.Errorf("key ID or data key too long")
+	}
+
+	raw := make([]byte, 0, len(headerMagic)+8+len(keyID)+len(dataKey))
+	raw = append(raw, headerMagic...)
+	raw = append(raw, headerVersion, byte(suite))
+	raw = append(raw, byte(len(keyID)>>8), byte(len(keyID)))
+	raw = append(raw, keyID...)
+	raw = append(raw, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(raw[len(raw)-4:], uint32(len(dataKey)))
+	raw = append(raw, dataKey...)
+
+	return &Header{
+		Version: headerVersion,
+		Suite:   suite,
+		KeyID:   keyID,
+		DataKey: dataKey,
+		raw:     raw,
+	}, nil
+}
+
+// readHeader reads a header, or if the ciphertext begins with something other
+// than the magic bytes, the data key of a version 0 secret.
+func readHeader(r *bufio.Reader) (*Header, error) {
+	if magic, err := r.Peek(len(headerMagic)); err != nil || !bytes.Equal(magic, headerMagic) {
+		// version 0 secrets are the data key length, the data key, and the
+		// payload
+		dataKey, err := readBlob(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return &Header{DataKey: dataKey}, nil
+	}
+
+	fixed := make([]byte, len(headerMagic)+2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, errTruncated
+	}
+
+	h := &Header{
+		Version: int(fixed[len(headerMagic)]),
+		Suite:   int(fixed[len(headerMagic)+1]),
+	}
+
+	if h.Version != headerVersion {
+		return nil, &FormatError{fmt.Sprintf("unsupported version %d", h.Version)}
+	}
+
+	if h.Suite != SuiteGCM && h.Suite != SuiteGCMStream {
+		return nil, &FormatError{fmt.Sprintf("unsupported cipher suite %d", h.Suite)}
+	}
+
+	keyID, err := readBlob(r, 2)
 	if err != nil {
 		return nil, err
 	}
+	h.KeyID = string(keyID)
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
+	if h.DataKey, err = readBlob(r, 4); err != nil {
 		return nil, err
 	}
 
-	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return newHeader(h.Suite, h.KeyID, h.DataKey)
+}
 
-	return gcm.Open(nil, nonce, ciphertext, data)
+// plaintextSize returns the size of the plaintext of a secret with the given
+// header and ciphertext size, including the header.
+func plaintextSize(h *Header, size int64) int64 {
+	switch {
+	case h.Version == 0:
+		// the data key's length and the data key, then the payload
+		size -= int64(4 + len(h.DataKey) + gcmOverhead)
+	case h.Suite == SuiteGCMStream:
+		size = streamPlaintextSize(size - int64(len(h.raw)))
+	default:
+		size -= int64(len(h.raw) + gcmOverhead)
+	}
+
+	if size < 0 {
+		return 0
+	}
+	return size
 }
 
-func encrypt(key, plaintext, data []byte) ([]byte, error) {
-	defer zero(key)
+// readBlob reads a blob preceded by its length, which is encoded as an integer
+// of the given number of bytes in network order.
+func readBlob(r io.Reader, size int) ([]byte, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b[4-size:]); err != nil {
+		return nil, errTruncated
+	}
 
-	block, err := aes.NewCipher(key)
+	n := binary.BigEndian.Uint32(b)
+	if n > maxKeyBlobSize {
+		return nil, &FormatError{fmt.Sprintf("%d-byte field is too long", n)}
+	}
+
+	b = make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errTruncated
+	}
+	return b, nil
+}
+
+// data returns the authenticated data for the payload which follows the header.
+func (h *Header) data() []byte {
+	return h.raw
+}
+
+func decrypt(key, ciphertext, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errTruncated
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, ciphertext, data)
+}
+
+func encrypt(key, plaintext, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
@@ -108,17 +309,15 @@ func encrypt(key, plaintext, data []byte) ([]byte, error) {
 	return gcm.Seal(nonce, nonce, plaintext, data), nil
 }
 
-func join(a, b []byte) []byte {
-	res := make([]byte, len(a)+len(b)+4)
-	binary.BigEndian.PutUint32(res, uint32(len(a)))
-	copy(res[4:], a)
-	copy(res[len(a)+4:], b)
-	return res
-}
+// newGCM returns an AES-GCM AEAD using the given key, which is zeroed.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	defer zero(key)
 
-func split(v []byte) ([]byte, []byte) {
-	l := binary.BigEndian.Uint32(v)
-	return v[4 : 4+l], v[4+l:]
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
 
 func zero(b []byte) {
@@ -126,3 +325,15 @@ func zero(b []byte) {
 		b[i] = 0
 	}
 }
+
+var (
+	headerMagic = []byte("SNKR")
+
+	errTruncated = &FormatError{"truncated"}
+)
+
+const (
+	headerVersion  = 1
+	maxKeyBlobSize = 64 * 1024
+	gcmOverhead    = 12 + 16 // the nonce and tag
+)
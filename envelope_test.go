@@ -45,3 +45,149 @@ func TestEnvelopeRoundTrip(t *testing.T) {
 		t.Errorf("Was %x but expected %x", plaintext, expected)
 	}
 }
+
+func TestEnvelopeLegacy(t *testing.T) {
+	ciphertext, err := encrypt(make([]byte, 32), []byte("this is a test"), []byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext = append([]byte{0x00, 0x00, 0x00, 0x03, 'y', 'a', 'y'}, ciphertext...)
+
+	envelope := Envelope{
+		KMS: &FakeKMS{
+			DecryptOutputs: []kms.DecryptOutput{
+				{
+					KeyId:     aws.String("key1"),
+					Plaintext: make([]byte, 32),
+				},
+			},
+		},
+	}
+
+	plaintext, err := envelope.Open(nil, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(plaintext), "this is a test"; v != want {
+		t.Errorf("Plaintext was %q, but expected %q", v, want)
+	}
+
+	h, err := ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := h.Version, 0; v != want {
+		t.Errorf("Version was %d, but expected %d", v, want)
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	envelope := Envelope{
+		KMS: testKeyring(t),
+	}
+
+	ciphertext, err := envelope.Seal("key1", nil, []byte("this is the plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := h.Version, 1; v != want {
+		t.Errorf("Version was %d, but expected %d", v, want)
+	}
+
+	if v, want := h.Suite, SuiteGCM; v != want {
+		t.Errorf("Suite was %d, but expected %d", v, want)
+	}
+
+	if v, want := h.KeyID, "key1"; v != want {
+		t.Errorf("Key ID was %q, but expected %q", v, want)
+	}
+}
+
+func TestPlaintextSize(t *testing.T) {
+	envelope := Envelope{
+		KMS: testKeyring(t),
+	}
+
+	for _, n := range []int{0, 1, 1000, streamChunkSize, 3*streamChunkSize + 100} {
+		plaintext := make([]byte, n)
+
+		sealed, err := envelope.Seal("key1", nil, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ciphertext := range [][]byte{sealed, seal(t, envelope, nil, plaintext)} {
+			h, err := ReadHeader(bytes.NewReader(ciphertext))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v, want := plaintextSize(h, int64(len(ciphertext))), int64(n); v != want {
+				t.Errorf("Suite %d size was %d, but expected %d", h.Suite, v, want)
+			}
+		}
+	}
+
+	legacy, err := encrypt(make([]byte, 32), []byte("this is a test"), []byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy = append([]byte{0x00, 0x00, 0x00, 0x03, 'y', 'a', 'y'}, legacy...)
+
+	h, err := ReadHeader(bytes.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := plaintextSize(h, int64(len(legacy))), int64(14); v != want {
+		t.Errorf("Legacy size was %d, but expected %d", v, want)
+	}
+}
+
+func TestEnvelopeMalformed(t *testing.T) {
+	envelope := Envelope{
+		KMS: testKeyring(t),
+	}
+
+	ciphertext, err := envelope.Seal("key1", nil, []byte("this is the plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every truncation must fail cleanly
+	for i := 0; i < len(ciphertext); i++ {
+		if _, err := envelope.Open(nil, ciphertext[:i]); err == nil {
+			t.Errorf("Opened a ciphertext truncated to %d bytes", i)
+		}
+	}
+
+	for _, c := range [][]byte{
+		nil,
+		[]byte("SNK"),
+		[]byte("SNKR"),
+		[]byte("SNKR\x09\x01"),
+		[]byte("SNKR\x01\x09"),
+		[]byte("SNKR\x01\x01\xff\xff"),
+		[]byte{0xff, 0xff, 0xff, 0xff},
+	} {
+		_, err := envelope.Open(nil, c)
+		if _, ok := err.(*FormatError); !ok {
+			t.Errorf("Error for %q was %v, but expected a *FormatError", c, err)
+		}
+	}
+
+	// the key ID in the header is authenticated
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[10] = 'x'
+	if _, err := envelope.Open(nil, tampered); err == nil {
+		t.Error("Opened a ciphertext with a modified key ID")
+	}
+}
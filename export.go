@@ -0,0 +1,347 @@
+package sneaker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The formats supported by Export and Import.
+const (
+	// FormatDotenv is NAME="value" lines, as parsed by ParseDotenv.
+	FormatDotenv = "dotenv"
+
+	// FormatShell is export NAME='value' lines, which can be sourced by a
+	// POSIX shell.
+	FormatShell = "shell"
+
+	// FormatJSON is a JSON object of strings.
+	FormatJSON = "json"
+
+	// FormatYAML is a YAML mapping of strings.
+	FormatYAML = "yaml"
+)
+
+// Export writes the given values as a single document in the given format,
+// sorted by key. Values must be valid UTF-8, and in the dotenv and shell
+// formats, keys must be valid environment variable names.
+func Export(w io.Writer, format string, values map[string][]byte) error {
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		if !utf8.Valid(v) {
+			return fmt.Errorf("%s isn't valid UTF-8", k)
+		}
+
+		if (format == FormatDotenv || format == FormatShell) && !envNamePattern.MatchString(k) {
+			return fmt.Errorf("%q isn't a valid variable name", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(nil)
+	switch format {
+	case FormatDotenv:
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s=%s\n", k, dotenvQuote(string(values[k])))
+		}
+	case FormatShell:
+		for _, k := range keys {
+			fmt.Fprintf(buf, "export %s=%s\n", k, shellQuote(string(values[k])))
+		}
+	case FormatJSON:
+		m := make(map[string]string, len(values))
+		for k, v := range values {
+			m[k] = string(v)
+		}
+
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	case FormatYAML:
+		// JSON strings are valid double-quoted YAML scalars
+		for _, k := range keys {
+			fmt.Fprintf(buf, "%s: %s\n", jsonQuote(k), jsonQuote(string(values[k])))
+		}
+	default:
+		return fmt.Errorf("unknown format: %q", format)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Import parses a document in the given format, as written by Export, and
+// returns its values by key. Only a flat mapping of keys to strings is
+// supported in YAML, with plain, quoted, and literal block (|) values.
+func Import(format string, b []byte) (map[string][]byte, error) {
+	var (
+		vars map[string]string
+		err  error
+	)
+
+	switch format {
+	case FormatDotenv:
+		vars, err = ParseDotenv(b)
+	case FormatShell:
+		vars, err = parseShell(b)
+	case FormatJSON:
+		err = json.Unmarshal(b, &vars)
+	case FormatYAML:
+		vars, err = parseYAML(b)
+	default:
+		return nil, fmt.Errorf("unknown format: %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(vars))
+	for k, v := range vars {
+		values[k] = []byte(v)
+	}
+	return values, nil
+}
+
+// dotenvQuote double-quotes the given value with the escapes ParseDotenv
+// understands.
+func dotenvQuote(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	).Replace(s) + `"`
+}
+
+// shellQuote single-quotes the given value, which the shell takes literally,
+// except for single quotes, which are closed, escaped, and reopened.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func jsonQuote(s string) string {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // strings always encode
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// parseShell parses export NAME='value' lines, in which values are
+// concatenations of single-quoted strings, which may span lines, and escaped
+// characters.
+func parseShell(b []byte) (map[string]string, error) {
+	vars := map[string]string{}
+
+	s, line := string(b), 1
+	for s != "" {
+		// skip blank lines and comments
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			i = len(s)
+		}
+
+		if l := strings.TrimSpace(s[:i]); l == "" || l[0] == '#' {
+			s = strings.TrimPrefix(s[i:], "\n")
+			line++
+			continue
+		}
+
+		s = strings.TrimLeft(s, " \t")
+		s = strings.TrimPrefix(s, "export ")
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 1 || strings.IndexByte(s[:eq], '\n') >= 0 {
+			return nil, fmt.Errorf("line %d: expected NAME=value", line)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value bytes.Buffer
+	word:
+		for s != "" {
+			switch s[0] {
+			case '\'':
+				end := strings.IndexByte(s[1:], '\'')
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unterminated quote", line)
+				}
+				value.WriteString(s[1 : end+1])
+				line += strings.Count(s[1:end+1], "\n")
+				s = s[end+2:]
+			case '\\':
+				if len(s) < 2 {
+					return nil, fmt.Errorf("line %d: trailing backslash", line)
+				}
+				value.WriteByte(s[1])
+				s = s[2:]
+			case ' ', '\t', '\n':
+				break word
+			default:
+				value.WriteByte(s[0])
+				s = s[1:]
+			}
+		}
+		vars[name] = value.String()
+
+		// the rest of the line may only be a comment
+		i = strings.IndexByte(s, '\n')
+		if i < 0 {
+			i = len(s)
+		}
+
+		if rest := strings.TrimSpace(s[:i]); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("line %d: unexpected %q", line, rest)
+		}
+		s = strings.TrimPrefix(s[i:], "\n")
+		line++
+	}
+	return vars, nil
+}
+
+// parseYAML parses a flat YAML mapping of keys to strings.
+func parseYAML(b []byte) (map[string]string, error) {
+	vars := map[string]string{}
+
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimRight(lines[n], " \t")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed[0] == '#' || trimmed == "---" {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values aren't supported", n+1)
+		}
+
+		key, rest, err := yamlScalar(line, true)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n+1, err)
+		}
+
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, ":") {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+		rest = strings.TrimSpace(rest[1:])
+
+		if rest == "|" || rest == "|-" {
+			// a literal block: the following more-indented lines
+			var block []string
+			indent := -1
+			for n+1 < len(lines) {
+				next := lines[n+1]
+				if strings.TrimSpace(next) == "" {
+					block = append(block, "")
+					n++
+					continue
+				}
+
+				i := len(next) - len(strings.TrimLeft(next, " "))
+				if i == 0 {
+					break
+				}
+
+				if indent < 0 {
+					indent = i
+				} else if i < indent {
+					return nil, fmt.Errorf("line %d: bad indentation", n+2)
+				}
+				block = append(block, next[indent:])
+				n++
+			}
+
+			// trailing blank lines belong to the document, not the value
+			for len(block) > 0 && block[len(block)-1] == "" {
+				block = block[:len(block)-1]
+			}
+
+			value := strings.Join(block, "\n")
+			if rest == "|" && len(block) > 0 {
+				value += "\n"
+			}
+			vars[key] = value
+			continue
+		}
+
+		value, rest, err := yamlScalar(rest, false)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n+1, err)
+		}
+
+		if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("line %d: unexpected %q", n+1, rest)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// yamlScalar parses a double-quoted, single-quoted, or plain scalar from the
+// beginning of the given string, returning it and the rest of the string.
+// Plain keys end at a colon, and plain values at a comment.
+func yamlScalar(s string, key bool) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				var v string
+				if err := json.Unmarshal([]byte(s[:i+1]), &v); err != nil {
+					return "", "", fmt.Errorf("bad quoted string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated quote")
+	case strings.HasPrefix(s, "'"):
+		var buf bytes.Buffer
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					buf.WriteByte('\'')
+					i++
+					continue
+				}
+				return buf.String(), s[i+1:], nil
+			}
+			buf.WriteByte(s[i])
+		}
+		return "", "", fmt.Errorf("unterminated quote")
+	case key:
+		i := strings.Index(s, ":")
+		if i < 0 {
+			return "", "", fmt.Errorf("expected key: value")
+		}
+		return strings.TrimSpace(s[:i]), s[i:], nil
+	default:
+		if i := strings.Index(s, " #"); i >= 0 {
+			return strings.TrimSpace(s[:i]), s[i:], nil
+		}
+		return s, "", nil
+	}
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
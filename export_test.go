@@ -0,0 +1,146 @@
+package sneaker
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	values := map[string][]byte{
+		"PLAIN":    []byte("hunter2"),
+		"QUOTES":   []byte(`it's "quoted" \ # not a comment`),
+		"LINES":    []byte("one\ntwo\r\n\tthree\n"),
+		"UNICODE":  []byte("snowman ☃ <&>"),
+		"SPACES":   []byte("  padded  "),
+		"EMPTY":    []byte(""),
+		"DOLLARS":  []byte("$HOME `pwd`"),
+		"_UNDER_1": []byte("x"),
+	}
+
+	for _, format := range []string{FormatDotenv, FormatShell, FormatJSON, FormatYAML} {
+		buf := bytes.NewBuffer(nil)
+		if err := Export(buf, format, values); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		actual, err := Import(format, buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", format, err, buf)
+		}
+
+		if !reflect.DeepEqual(actual, values) {
+			t.Errorf("%s: was %q, but expected %q\n%s", format, actual, values, buf)
+		}
+	}
+}
+
+func TestExportPaths(t *testing.T) {
+	values := map[string][]byte{
+		"db/password": []byte("hunter2"),
+		"api: key":    []byte("secret"),
+	}
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		buf := bytes.NewBuffer(nil)
+		if err := Export(buf, format, values); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		actual, err := Import(format, buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		if !reflect.DeepEqual(actual, values) {
+			t.Errorf("%s: was %q, but expected %q", format, actual, values)
+		}
+	}
+
+	for _, format := range []string{FormatDotenv, FormatShell} {
+		if err := Export(bytes.NewBuffer(nil), format, values); err == nil {
+			t.Errorf("%s: exported paths as variable names", format)
+		}
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	if err := Export(bytes.NewBuffer(nil), FormatJSON, map[string][]byte{
+		"binary": {0xff, 0xfe},
+	}); err == nil {
+		t.Error("Exported invalid UTF-8")
+	}
+
+	if err := Export(bytes.NewBuffer(nil), "toml", nil); err == nil {
+		t.Error("Exported an unknown format")
+	}
+}
+
+func TestImportYAML(t *testing.T) {
+	doc := `---
+# database
+db/password: hunter2 # not part of the value
+"db/user": 'o''brien'
+api/key: "line\nbreak"
+empty:
+cert: |
+  -----BEGIN-----
+
+  abc
+  -----END-----
+
+chomped: |-
+  no newline
+`
+
+	actual, err := Import(FormatYAML, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]byte{
+		"db/password": []byte("hunter2"),
+		"db/user":     []byte("o'brien"),
+		"api/key":     []byte("line\nbreak"),
+		"empty":       []byte(""),
+		"cert":        []byte("-----BEGIN-----\n\nabc\n-----END-----\n"),
+		"chomped":     []byte("no newline"),
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Was %q, but expected %q", actual, expected)
+	}
+
+	for _, doc := range []string{
+		"nested:\n  key: value\n",
+		"key: \"unterminated\n",
+		"no colon\n",
+	} {
+		if _, err := Import(FormatYAML, []byte(doc)); err == nil {
+			t.Errorf("Parsed %q", doc)
+		}
+	}
+}
+
+func TestImportShell(t *testing.T) {
+	doc := "# comment\nexport A='multi\nline'\nB=it\\''s' # comment\nexport C=\n"
+
+	actual, err := Import(FormatShell, []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]byte{
+		"A": []byte("multi\nline"),
+		"B": []byte("it's"),
+		"C": []byte(""),
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Was %q, but expected %q", actual, expected)
+	}
+
+	if _, err := Import(FormatShell, []byte("A='unterminated\n")); err == nil {
+		t.Error("Parsed an unterminated quote")
+	}
+}
@@ -0,0 +1,343 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExtractOptions control how Extract writes secrets.
+type ExtractOptions struct {
+	// Mode is the permissions of extracted secrets. If zero, 0400 is used.
+	Mode os.FileMode
+
+	// DirMode is the permissions of the directory and its subdirectories. If
+	// zero, 0700 is used.
+	DirMode os.FileMode
+
+	// Chown is whether to change the owner of the directory and everything in
+	// it to UID and GID. Otherwise, they're owned by the current user.
+	Chown    bool
+	UID, GID int
+
+	// Prune is whether to remove files in the directory which aren't in the
+	// pack. Otherwise, they're kept as they are.
+	Prune bool
+
+	// Only is a pattern of paths to extract, in the form used by List. If
+	// blank, every secret in the pack is extracted.
+	Only string
+}
+
+// Extract decrypts a pack written by Pack using KMS and the given context, and
+// writes the secrets in it to the given directory, returning their paths. The
+// secrets are extracted to a temporary directory next to the given directory,
+// which then replaces it, so the directory only ever contains a complete set
+// of secrets. (On most platforms, the old directory is renamed out of the way
+// before the new one is renamed into place, so it's briefly missing.) If the
+// pack can't be extracted, the directory is left as it was.
+//
+// Secrets are written with the permissions and owner given in the options,
+// regardless of those in the pack. Packs with entries which aren't regular
+// files or directories, or whose paths lead out of the directory, are
+// rejected.
+//
+// Each secret is checked against the size and digest in the pack's manifest.
+// If any don't match, or are missing from the pack or the manifest, nothing is
+// extracted and the error is a PathErrors. Packs written before packs had
+// manifests are extracted without being checked.
+func (m *Manager) Extract(ctxt map[string]string, r io.Reader, dir string, opts ExtractOptions) ([]string, error) {
+	return m.ExtractContext(context.Background(), ctxt, r, dir, opts)
+}
+
+// ExtractContext is like Extract, but stops if ctx is done.
+func (m *Manager) ExtractContext(ctx context.Context, ctxt map[string]string, r io.Reader, dir string, opts ExtractOptions) ([]string, error) {
+	if opts.Mode == 0 {
+		opts.Mode = 0400
+	}
+
+	if opts.DirMode == 0 {
+		opts.DirMode = 0700
+	}
+
+	dir = filepath.Clean(dir)
+	if info, err := os.Lstat(dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".sneaker-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	tr, err := m.UnpackContext(ctx, ctxt, r)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := extract(tar.NewReader(tr), tmp, opts.Only)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.Prune {
+		if err := keep(dir, tmp, paths); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := chmodAll(tmp, paths, opts); err != nil {
+		return nil, err
+	}
+
+	return paths, replaceDir(dir, tmp)
+}
+
+// extract writes the regular files in the given TAR file which match the
+// given pattern to the given directory, checking them against the manifest,
+// and returns their paths.
+func extract(tr *tar.Reader, dir, only string) ([]string, error) {
+	manifest, hdr, err := readManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]ManifestEntry
+	if manifest != nil {
+		entries = manifest.entries()
+	}
+
+	extracted := map[string]bool{}
+	errs := PathErrors{}
+	for ; ; hdr = nil {
+		if hdr == nil {
+			if hdr, err = tr.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		name, err := extractPath(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg, tar.TypeRegA:
+		default:
+			return nil, fmt.Errorf("%s: unsupported file type %q", hdr.Name, hdr.Typeflag)
+		}
+
+		p := filepath.ToSlash(name)
+		if ok, err := included(only, p); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			if name != "" {
+				if err := os.MkdirAll(filepath.Join(dir, name), 0700); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("invalid path: %q", hdr.Name)
+		}
+
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), tr)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+
+		extracted[p] = true
+
+		if entries == nil {
+			continue
+		}
+
+		switch e, ok := entries[p]; {
+		case !ok:
+			errs[p] = errors.New("not in the manifest")
+		case n != e.Size:
+			errs[p] = fmt.Errorf("size is %d bytes, but the manifest has %d", n, e.Size)
+		case sha256Hex(h) != e.SHA256:
+			errs[p] = errors.New("digest does not match the manifest")
+		}
+	}
+
+	for p := range entries {
+		if ok, err := included(only, p); err != nil {
+			return nil, err
+		} else if ok && !extracted[p] {
+			errs[p] = errors.New("missing from the pack")
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	paths := make([]string, 0, len(extracted))
+	for p := range extracted {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// included returns whether the given path matches the pattern, or true if the
+// pattern is blank.
+func included(pattern, p string) (bool, error) {
+	if pattern == "" || p == "" {
+		return true, nil
+	}
+	return match(pattern, p)
+}
+
+// extractPath returns the relative path of the file the given TAR entry
+// should be extracted to, or an error if it's absolute or leads out of the
+// directory being extracted to.
+func extractPath(name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../") ||
+		strings.ContainsRune(name, '\\') {
+		return "", fmt.Errorf("invalid path: %q", name)
+	}
+
+	if clean == "." {
+		return "", nil
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+// keep links the files in the old directory which aren't in the given list of
+// extracted paths into the new directory, so they're kept when the new
+// directory replaces the old one.
+func keep(old, dir string, extracted []string) error {
+	skip := make(map[string]bool, len(extracted))
+	for _, p := range extracted {
+		skip[filepath.FromSlash(p)] = true
+	}
+
+	err := filepath.Walk(old, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(old, file)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, rel)
+		switch {
+		case rel == ".":
+			return nil
+		case info.IsDir():
+			return os.MkdirAll(target, 0700)
+		case skip[rel]:
+			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			// a secret may have been replaced by a directory of secrets
+			if _, err := os.Lstat(target); err == nil {
+				return nil
+			}
+			return os.Link(file, target)
+		}
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// chmodAll sets the permissions and owner of the given directory, its
+// subdirectories, and the given extracted secrets in it. Files kept from the
+// old directory are left as they are.
+func chmodAll(dir string, extracted []string, opts ExtractOptions) error {
+	secrets := make(map[string]bool, len(extracted))
+	for _, p := range extracted {
+		secrets[filepath.FromSlash(p)] = true
+	}
+
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+
+		mode := opts.Mode
+		if info.IsDir() {
+			mode = opts.DirMode
+		} else if !secrets[rel] {
+			return nil
+		}
+
+		if opts.Chown {
+			if err := os.Chown(file, opts.UID, opts.GID); err != nil {
+				return err
+			}
+		}
+		return os.Chmod(file, mode)
+	})
+}
+
+// replaceDir replaces the old directory, if it exists, with the new one. If the
+// new directory can't be renamed into place, the old one is restored.
+func replaceDir(old, dir string) error {
+	if _, err := os.Lstat(old); os.IsNotExist(err) {
+		return os.Rename(dir, old)
+	}
+
+	backup := dir + ".old"
+	if err := os.Rename(old, backup); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dir, old); err != nil {
+		_ = os.Rename(backup, old)
+		return err
+	}
+	return os.RemoveAll(backup)
+}
@@ -0,0 +1,262 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+	dir := filepath.Join(root, "secrets")
+
+	pack := func(secrets map[string][]byte) []byte {
+		buf := bytes.NewBuffer(nil)
+		if err := man.Pack(secrets, nil, "", buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	first := pack(map[string][]byte{
+		"db/password": []byte("hunter2"),
+		"api.key":     []byte("key"),
+	})
+
+	paths, err := man.Extract(nil, bytes.NewReader(first), dir, ExtractOptions{Mode: 0440})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := paths, []string{"api.key", "db/password"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Paths were %v, but expected %v", v, want)
+	}
+
+	assertFile(t, filepath.Join(dir, "db", "password"), "hunter2", 0440)
+	assertFile(t, filepath.Join(dir, "api.key"), "key", 0440)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := info.Mode().Perm(), os.FileMode(0700); v != want {
+		t.Errorf("Directory mode was %v, but expected %v", v, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "local"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second := pack(map[string][]byte{
+		"db/password": []byte("hunter3"),
+	})
+
+	if _, err := man.Extract(nil, bytes.NewReader(second), dir, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFile(t, filepath.Join(dir, "db", "password"), "hunter3", 0400)
+	assertFile(t, filepath.Join(dir, "api.key"), "key", 0440)
+	assertFile(t, filepath.Join(dir, "local"), "local", 0644)
+
+	if _, err := man.Extract(nil, bytes.NewReader(second), dir, ExtractOptions{Prune: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Errorf("Directory had %d files, but expected %d", v, want)
+	}
+
+	files, err = ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Errorf("Left %d files next to the directory, but expected %d", v, want)
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+	dir := filepath.Join(root, "secrets")
+
+	for _, hdr := range []tar.Header{
+		{Name: "../evil", Typeflag: tar.TypeReg},
+		{Name: "/etc/evil", Typeflag: tar.TypeReg},
+		{Name: "a/../../evil", Typeflag: tar.TypeReg},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+	} {
+		buf := bytes.NewBuffer(nil)
+		w, err := man.Envelope.SealWriter(man.KeyId, nil, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tw := tar.NewWriter(w)
+		hdr := hdr
+		hdr.Mode = 0600
+		hdr.Size = 0
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := man.Extract(nil, buf, dir, ExtractOptions{}); err == nil {
+			t.Errorf("Extracted %s", hdr.Name)
+		}
+	}
+
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 0; v != want {
+		t.Errorf("Left %d files, but expected %d", v, want)
+	}
+}
+
+func TestExtractOnly(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+	dir := filepath.Join(root, "secrets")
+
+	buf := bytes.NewBuffer(nil)
+	if err := man.Pack(map[string][]byte{
+		"db/password": []byte("hunter2"),
+		"certs/a.pem": []byte("A"),
+		"certs/b.pem": []byte("B"),
+	}, nil, "", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := man.Extract(nil, buf, dir, ExtractOptions{Only: "certs/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := paths, []string{"certs/a.pem", "certs/b.pem"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Paths were %v, but expected %v", v, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "db")); !os.IsNotExist(err) {
+		t.Errorf("Extracted db/password")
+	}
+}
+
+func TestExtractCorrupt(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+	dir := filepath.Join(root, "secrets")
+
+	manifest, err := json.Marshal(&Manifest{
+		Entries: []ManifestEntry{
+			{
+				Path:   "api.key",
+				Size:   3,
+				SHA256: "2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683",
+			},
+			{
+				Path:   "db/password",
+				Size:   7,
+				SHA256: "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7",
+			},
+			{
+				Path:   "missing",
+				Size:   1,
+				SHA256: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := sealTar(t, man, func(tw *tar.Writer) {
+		for _, f := range []struct{ name, data string }{
+			{manifestName, string(manifest)},
+			{"api.key", "key"},
+			{"db/password", "hunter3"},
+			{"extra", "extra"},
+		} {
+			if err := packFile(tw, f.name, int64(len(f.data)), strings.NewReader(f.data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	_, err = man.Extract(nil, buf, dir, ExtractOptions{})
+	errs, ok := err.(PathErrors)
+	if !ok {
+		t.Fatalf("Error was %v, but expected PathErrors", err)
+	}
+
+	var paths []string
+	for p := range errs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if v, want := paths, []string{"db/password", "extra", "missing"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Failed paths were %v, but expected %v", v, want)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Extracted a corrupt pack")
+	}
+}
+
+func assertFile(t *testing.T, name, contents string, mode os.FileMode) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), contents; v != want {
+		t.Errorf("%s was %q, but expected %q", name, v, want)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := info.Mode().Perm(), mode; v != want {
+		t.Errorf("%s mode was %v, but expected %v", name, v, want)
+	}
+}
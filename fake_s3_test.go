@@ -1,6 +1,13 @@
 package sneaker
 
-import "github.com/aws/aws-sdk-go/service/s3"
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
 
 type FakeS3 struct {
 	ListInputs  []s3.ListObjectsInput
@@ -14,6 +21,12 @@ type FakeS3 struct {
 
 	GetInputs  []s3.GetObjectInput
 	GetOutputs []s3.GetObjectOutput
+
+	HeadInputs  []s3.HeadObjectInput
+	HeadOutputs []s3.HeadObjectOutput
+
+	VersionsInputs  []s3.ListObjectVersionsInput
+	VersionsOutputs []s3.ListObjectVersionsOutput
 }
 
 func (f *FakeS3) ListObjects(req *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
@@ -31,6 +44,15 @@ func (f *FakeS3) DeleteObject(req *s3.DeleteObjectInput) (*s3.DeleteObjectOutput
 }
 
 func (f *FakeS3) PutObject(req *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	// like S3, consume the body before returning
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = bytes.NewReader(b)
+	}
+
 	f.PutInputs = append(f.PutInputs, *req)
 	resp := f.PutOutputs[0]
 	f.PutOutputs = f.PutOutputs[1:]
@@ -43,3 +65,51 @@ func (f *FakeS3) GetObject(req *s3.GetObjectInput) (*s3.GetObjectOutput, error)
 	f.GetOutputs = f.GetOutputs[1:]
 	return &resp, nil
 }
+
+func (f *FakeS3) HeadObject(req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	f.HeadInputs = append(f.HeadInputs, *req)
+	resp := f.HeadOutputs[0]
+	f.HeadOutputs = f.HeadOutputs[1:]
+	return &resp, nil
+}
+
+// paginate splits the given objects into pages of the given size, truncated as
+// S3 truncates them for requests without a delimiter: IsTruncated is set on
+// all but the last page, and NextMarker is never set.
+func paginate(objects []*s3.Object, size int) []s3.ListObjectsOutput {
+	var pages []s3.ListObjectsOutput
+	for len(objects) > size {
+		pages = append(pages, s3.ListObjectsOutput{
+			Contents:    objects[:size],
+			IsTruncated: aws.Bool(true),
+		})
+		objects = objects[size:]
+	}
+	return append(pages, s3.ListObjectsOutput{
+		Contents:    objects,
+		IsTruncated: aws.Bool(false),
+	})
+}
+
+func (f *FakeS3) ListObjectVersions(req *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	f.VersionsInputs = append(f.VersionsInputs, *req)
+	resp := f.VersionsOutputs[0]
+	f.VersionsOutputs = f.VersionsOutputs[1:]
+	return &resp, nil
+}
+
+// described returns HEAD responses for secrets with the given key IDs and
+// sizes, as uploaded with their metadata.
+func described(files ...File) []s3.HeadObjectOutput {
+	var heads []s3.HeadObjectOutput
+	for _, f := range files {
+		heads = append(heads, s3.HeadObjectOutput{
+			Metadata: map[string]*string{
+				"Sneaker-Key-Id": aws.String(f.KeyId),
+				"Sneaker-Format": aws.String("1"),
+				"Sneaker-Size":   aws.String(strconv.Itoa(f.Size)),
+			},
+		})
+	}
+	return heads
+}
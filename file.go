@@ -0,0 +1,22 @@
+package sneaker
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// removeFile removes the named file, if it exists, along with any directories
+// it leaves empty, up to but not including the given root directory.
+func removeFile(root, name string) error {
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	root = filepath.Clean(root)
+	for d := filepath.Dir(name); d != root && d != filepath.Dir(d); d = filepath.Dir(d) {
+		if os.Remove(d) != nil {
+			break // not empty
+		}
+	}
+	return nil
+}
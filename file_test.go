@@ -0,0 +1,41 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveFile(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"a/b/c", "a/d"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(name, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeFile(root, filepath.Join(root, "a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "a", "b")); !os.IsNotExist(err) {
+		t.Error("Left an empty directory behind")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "a", "d")); err != nil {
+		t.Errorf("Removed another file: %v", err)
+	}
+
+	// removing a file which doesn't exist isn't an error
+	if err := removeFile(root, filepath.Join(root, "a", "b", "c")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,587 @@
+package sneaker
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/codahale/sneaker/internal/atomicfile"
+)
+
+// FileStorage is an ObjectStorage implementation which keeps objects as files
+// in a directory on the local filesystem. Each object is stored at
+// Root/Bucket/Key; if the bucket is blank, objects are stored directly under
+// Root. Writes are performed by writing a temporary file and renaming it into
+// place, so readers never observe partially-written objects. Object metadata,
+// along with the object's ETag, is kept in a hidden file alongside each
+// object. Like an S3 bucket without versioning, only the latest version of each
+// object is kept. Objects are streamed to and from their files, so objects of
+// any size can be read and written in bounded memory.
+//
+// Unlike S3, FileStorage supports conditional writes: writes and deletes are
+// serialized by a lock file in Root, so PutObjectIfMatch can check an object
+// and replace it atomically, even across processes.
+type FileStorage struct {
+	Root string
+
+	mu sync.Mutex
+}
+
+// ListObjects returns the objects whose keys begin with the given prefix, in
+// lexicographic order. Like S3, it returns at most MaxKeys (or 1000) objects at
+// a time, starting after Marker.
+func (fs *FileStorage) ListObjects(req *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	root := fs.bucket(req.Bucket)
+	prefix := aws.StringValue(req.Prefix)
+	marker := aws.StringValue(req.Marker)
+
+	var keys []string
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), fsReserved) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	max := int(aws.Int64Value(req.MaxKeys))
+	if max <= 0 || max > 1000 {
+		max = 1000
+	}
+
+	resp := &s3.ListObjectsOutput{
+		Name:        req.Bucket,
+		Prefix:      req.Prefix,
+		Marker:      req.Marker,
+		MaxKeys:     aws.Int64(int64(max)),
+		IsTruncated: aws.Bool(len(keys) > max),
+	}
+
+	if len(keys) > max {
+		keys = keys[:max]
+		resp.NextMarker = aws.String(keys[max-1])
+	}
+
+	for _, key := range keys {
+		name := filepath.Join(root, filepath.FromSlash(key))
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// use the cached ETag, unless the object has been replaced without
+		// its metadata file, e.g. by a put which was interrupted
+		md, err := fsReadMetadata(name)
+		if err != nil {
+			return nil, err
+		}
+
+		etag := md.ETag
+		if !md.describes(info) {
+			if etag, err = fsETag(name); err != nil {
+				return nil, err
+			}
+		}
+
+		resp.Contents = append(resp.Contents, &s3.Object{
+			Key:          aws.String(key),
+			ETag:         aws.String(etag),
+			Size:         aws.Int64(info.Size()),
+			LastModified: aws.Time(info.ModTime()),
+		})
+	}
+
+	return resp, nil
+}
+
+// ListObjectVersions returns the objects whose keys begin with the given
+// prefix, each with a single version whose ID is "null".
+func (fs *FileStorage) ListObjectVersions(req *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	objects, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket:  req.Bucket,
+		Prefix:  req.Prefix,
+		Marker:  req.KeyMarker,
+		MaxKeys: req.MaxKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &s3.ListObjectVersionsOutput{
+		Name:          objects.Name,
+		Prefix:        objects.Prefix,
+		KeyMarker:     objects.Marker,
+		MaxKeys:       objects.MaxKeys,
+		IsTruncated:   objects.IsTruncated,
+		NextKeyMarker: objects.NextMarker,
+	}
+
+	for _, obj := range objects.Contents {
+		resp.Versions = append(resp.Versions, &s3.ObjectVersion{
+			Key:          obj.Key,
+			VersionId:    aws.String(fsVersion),
+			IsLatest:     aws.Bool(true),
+			ETag:         obj.ETag,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+	}
+
+	return resp, nil
+}
+
+// GetObject returns the contents of the given object, or if a range (e.g.
+// bytes=0-1023) is given, that range of them. The only version of an object is
+// its latest, "null".
+func (fs *FileStorage) GetObject(req *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	name, err := fs.path(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := aws.StringValue(req.VersionId); v != "" && v != fsVersion {
+		return nil, awserr.NewRequestFailure(
+			awserr.New("NoSuchVersion", fmt.Sprintf("no such version: %q", v), nil),
+			404, "",
+		)
+	}
+
+	// the open file is read, even if it's replaced while it's being read, so
+	// the ETag and metadata always describe the returned body
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errNoSuchKey(*req.Key)
+		}
+		return nil, err
+	}
+
+	resp, err := fsGetObject(f, name, aws.StringValue(req.Range))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fsGetObject returns the given range of the open object with the given name,
+// or if the range is blank, all of it.
+func fsGetObject(f *os.File, name, rng string) (*s3.GetObjectOutput, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := fsReadMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the metadata file is written after the object, so until it is, it
+	// belongs to the object's previous version
+	tag := md.ETag
+	if !md.describes(info) {
+		if tag, err = fsHash(f); err != nil {
+			return nil, err
+		}
+		md.Metadata = nil
+	}
+
+	first, last := int64(0), info.Size()-1
+	if rng != "" {
+		if first, last, err = fsRange(rng, info.Size()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &s3.GetObjectOutput{
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, first, last-first+1), f},
+		ContentLength: aws.Int64(last - first + 1),
+		ContentType:   aws.String(contentType),
+		ETag:          aws.String(tag),
+		LastModified:  aws.Time(info.ModTime()),
+		Metadata:      md.Metadata,
+		VersionId:     aws.String(fsVersion),
+	}
+	if rng != "" {
+		resp.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", first, last, info.Size()))
+	}
+	return resp, nil
+}
+
+// fsRange returns the first and last offsets of the given HTTP byte range
+// (bytes=first-last, bytes=first-, or bytes=-suffix) of an object of the given
+// size. Like S3, ranges which extend past the end of the object are truncated,
+// and ranges which start after it are invalid.
+func fsRange(rng string, size int64) (int64, int64, error) {
+	invalid := awserr.NewRequestFailure(
+		awserr.New("InvalidRange", fmt.Sprintf("invalid range: %q", rng), nil),
+		416, "",
+	)
+
+	spec := strings.TrimPrefix(rng, "bytes=")
+	i := strings.IndexByte(spec, '-')
+	if spec == rng || i < 0 || strings.Contains(spec, ",") {
+		return 0, 0, invalid
+	}
+
+	first, last := int64(0), size-1
+	switch from, to := spec[:i], spec[i+1:]; {
+	case from == "":
+		n, err := strconv.ParseInt(to, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, invalid
+		}
+		if n < size {
+			first = size - n
+		}
+	default:
+		n, err := strconv.ParseInt(from, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, invalid
+		}
+		first = n
+
+		if to != "" {
+			n, err := strconv.ParseInt(to, 10, 64)
+			if err != nil || n < first {
+				return 0, 0, invalid
+			}
+			if n < last {
+				last = n
+			}
+		}
+	}
+
+	if first >= size {
+		return 0, 0, invalid
+	}
+	return first, last, nil
+}
+
+// HeadObject returns the metadata of the given object.
+func (fs *FileStorage) HeadObject(req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	resp, err := fs.GetObject(&s3.GetObjectInput{
+		Bucket: req.Bucket,
+		Key:    req.Key,
+	})
+	if err != nil {
+		if e, ok := err.(awserr.Error); ok && e.Code() == "NoSuchKey" {
+			// S3 doesn't return bodies, and therefore error codes, for HEAD
+			// requests
+			return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "")
+		}
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	return &s3.HeadObjectOutput{
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.ContentType,
+		ETag:          resp.ETag,
+		LastModified:  resp.LastModified,
+		Metadata:      resp.Metadata,
+		VersionId:     resp.VersionId,
+	}, nil
+}
+
+// PutObject atomically creates or replaces the given object.
+func (fs *FileStorage) PutObject(req *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	name, err := fs.path(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := fs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return fs.put(name, req)
+}
+
+// PutObjectIfMatch atomically creates or replaces the given object, but only if
+// the object it replaces has the given ETag, or if the ETag is blank, only if
+// there is no object to replace. Otherwise, it returns ErrModified.
+func (fs *FileStorage) PutObjectIfMatch(req *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	name, err := fs.path(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := fs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	current, err := fsETag(name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		current = ""
+	}
+
+	if unquote(current) != unquote(etag) {
+		return nil, ErrModified
+	}
+
+	return fs.put(name, req)
+}
+
+// put writes the given object to the named file. The caller must hold the lock.
+func (fs *FileStorage) put(name string, req *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, err
+	}
+
+	// the object is written first, so its metadata never describes an object
+	// which doesn't exist
+	h := md5.New()
+	if err := atomicfile.Write(name, 0600, func(w io.Writer) error {
+		if req.Body == nil {
+			return nil
+		}
+		_, err := io.Copy(io.MultiWriter(w, h), req.Body)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	tag := etag(h)
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := json.Marshal(fsMetadata{
+		ETag:     tag,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Metadata: req.Metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := atomicfile.WriteFile(fsMetadataPath(name), md, 0600); err != nil {
+		return nil, err
+	}
+
+	return &s3.PutObjectOutput{
+		ETag: aws.String(tag),
+	}, nil
+}
+
+// DeleteObject removes the given object, along with any directories left
+// empty by its removal. Like S3, deleting an object which does not exist is not
+// an error.
+func (fs *FileStorage) DeleteObject(req *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	name, err := fs.path(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := fs.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.Remove(fsMetadataPath(name)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	root := fs.bucket(req.Bucket)
+	for dir := filepath.Dir(name); dir != root; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty, or already gone
+		}
+	}
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// lock takes the lock which serializes writes to the storage, both within this
+// process and, where the platform supports it, across processes. The returned
+// function releases it.
+func (fs *FileStorage) lock() (func(), error) {
+	if err := os.MkdirAll(fs.Root, 0700); err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	f, err := os.OpenFile(filepath.Join(fs.Root, fsReserved+"lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		fs.mu.Unlock()
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		fs.mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+		fs.mu.Unlock()
+	}, nil
+}
+
+func (fs *FileStorage) bucket(bucket *string) string {
+	return filepath.Join(fs.Root, aws.StringValue(bucket))
+}
+
+func (fs *FileStorage) path(bucket, key *string) (string, error) {
+	k := aws.StringValue(key)
+	clean := filepath.Clean(filepath.FromSlash(k))
+	if k == "" || filepath.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) ||
+		strings.HasPrefix(filepath.Base(clean), fsReserved) {
+		return "", fmt.Errorf("invalid object key: %q", k)
+	}
+	return filepath.Join(fs.bucket(bucket), clean), nil
+}
+
+// fsMetadataPath returns the name of the file which holds the metadata of the
+// named object.
+func fsMetadataPath(name string) string {
+	return filepath.Join(filepath.Dir(name), fsReserved+"meta-"+filepath.Base(name))
+}
+
+// fsMetadata is the contents of an object's metadata file.
+type fsMetadata struct {
+	// ETag, Size, and ModTime describe the object as it was written, so the
+	// ETag can be listed without reading the object.
+	ETag    string `json:"etag"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+
+	Metadata map[string]*string `json:"metadata,omitempty"`
+}
+
+// describes returns whether the metadata was written for the object with the
+// given file info.
+func (md *fsMetadata) describes(info os.FileInfo) bool {
+	return md.ETag != "" && md.Size == info.Size() && md.ModTime == info.ModTime().UnixNano()
+}
+
+// fsReadMetadata returns the metadata file of the named object, with metadata
+// keys in the canonical form S3 returns them in. If it doesn't exist, the
+// returned metadata is empty.
+func fsReadMetadata(name string) (*fsMetadata, error) {
+	b, err := ioutil.ReadFile(fsMetadataPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &fsMetadata{}, nil
+		}
+		return nil, err
+	}
+
+	var md fsMetadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return nil, err
+	}
+
+	if md.Metadata != nil {
+		metadata := make(map[string]*string, len(md.Metadata))
+		for k, v := range md.Metadata {
+			metadata[http.CanonicalHeaderKey(k)] = v
+		}
+		md.Metadata = metadata
+	}
+	return &md, nil
+}
+
+// fsETag returns the ETag of the named object.
+func fsETag(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return fsHash(f)
+}
+
+// fsHash returns the ETag of the given open object, and seeks back to its
+// start.
+func fsHash(f *os.File) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return etag(h), nil
+}
+
+// etag returns the S3-style ETag (a quoted MD5 hash) of what was written to
+// the given MD5 hash.
+func etag(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+func errNoSuchKey(key string) error {
+	return awserr.NewRequestFailure(
+		awserr.New("NoSuchKey", fmt.Sprintf("no such key: %q", key), nil),
+		404, "",
+	)
+}
+
+const (
+	// fsReserved prefixes the names of files which FileStorage uses internally
+	// and which are never exposed as objects.
+	fsReserved = ".sneaker-"
+
+	// fsVersion is the version ID S3 gives objects in buckets without
+	// versioning.
+	fsVersion = "null"
+)
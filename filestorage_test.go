@@ -0,0 +1,392 @@
+package sneaker
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestFileStorageRoundTrip(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	fs := &FileStorage{Root: root}
+
+	put, err := fs.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secrets/weeble/wobble.txt"),
+		Body:   strings.NewReader("this is a test"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := *put.ETag, `"54b0c58c7ce9f2a8b551351102ee0938"`; v != want {
+		t.Errorf("ETag was %q, but expected %q", v, want)
+	}
+
+	info, err := os.Stat(filepath.Join(root, "bucket", "secrets", "weeble", "wobble.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := info.Mode().Perm(), os.FileMode(0600); v != want {
+		t.Errorf("Mode was %v, but expected %v", v, want)
+	}
+
+	list, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("secrets/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(list.Contents), 1; v != want {
+		t.Fatalf("Listed %d objects, but expected %d", v, want)
+	}
+
+	obj := list.Contents[0]
+	if v, want := *obj.Key, "secrets/weeble/wobble.txt"; v != want {
+		t.Errorf("Key was %q, but expected %q", v, want)
+	}
+
+	if v, want := *obj.ETag, *put.ETag; v != want {
+		t.Errorf("ETag was %q, but expected %q", v, want)
+	}
+
+	if v, want := *obj.Size, int64(14); v != want {
+		t.Errorf("Size was %d, but expected %d", v, want)
+	}
+
+	get, err := fs.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secrets/weeble/wobble.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer get.Body.Close()
+
+	b, err := ioutil.ReadAll(get.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), "this is a test"; v != want {
+		t.Errorf("Body was %q, but expected %q", v, want)
+	}
+
+	if _, err := fs.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secrets/weeble/wobble.txt"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "bucket", "secrets")); !os.IsNotExist(err) {
+		t.Errorf("Empty directories were not removed: %v", err)
+	}
+
+	_, err = fs.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secrets/weeble/wobble.txt"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != "NoSuchKey" {
+		t.Errorf("Error was %v, but expected NoSuchKey", err)
+	}
+}
+
+func TestFileStorageListEmpty(t *testing.T) {
+	fs := &FileStorage{Root: filepath.Join(os.TempDir(), "sneaker-does-not-exist")}
+
+	list, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := len(list.Contents); v != 0 {
+		t.Errorf("Listed %d objects, but expected none", v)
+	}
+}
+
+func TestFileStorageBadKey(t *testing.T) {
+	fs := &FileStorage{Root: os.TempDir()}
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/etc/passwd/../.."} {
+		if _, err := fs.PutObject(&s3.PutObjectInput{
+			Key:  aws.String(key),
+			Body: strings.NewReader("nope"),
+		}); err == nil {
+			t.Errorf("Key %q was accepted", key)
+		}
+	}
+}
+
+func TestFileStorageMetadata(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	fs := &FileStorage{Root: root}
+
+	if _, err := fs.PutObject(&s3.PutObjectInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("secret"),
+		Body:     strings.NewReader("this is a test"),
+		Metadata: map[string]*string{"sneaker-deleted-by": aws.String("alice")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := fs.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := aws.StringValue(head.Metadata["Sneaker-Deleted-By"]), "alice"; v != want {
+		t.Errorf("Metadata was %q, but expected %q", v, want)
+	}
+
+	list, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(list.Contents), 1; v != want {
+		t.Errorf("Listed %d objects, but expected %d", v, want)
+	}
+
+	// replacing an object replaces its metadata
+	if _, err := fs.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+		Body:   strings.NewReader("this is another test"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err = fs.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(head.Metadata) != 0 {
+		t.Errorf("Metadata was %v, but expected none", head.Metadata)
+	}
+}
+
+func TestFileStoragePutObjectIfMatch(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	fs := &FileStorage{Root: root}
+
+	put := func(body, etag string) (*s3.PutObjectOutput, error) {
+		return fs.PutObjectIfMatch(&s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("secret"),
+			Body:   strings.NewReader(body),
+		}, etag)
+	}
+
+	if _, err := put("one", `"nope"`); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	first, err := put("one", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := put("two", ""); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	if _, err := put("two", `"nope"`); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	if _, err := put("two", unquote(*first.ETag)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := fs.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), "two"; v != want {
+		t.Errorf("Body was %q, but expected %q", v, want)
+	}
+}
+
+func TestFileStoragePutObjectIfMatchConcurrent(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	// separate instances, as separate processes would have
+	var wg sync.WaitGroup
+	created := make(chan string, 10)
+	for i := 0; i < cap(created); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			fs := &FileStorage{Root: root}
+			body := fmt.Sprintf("body %d", i)
+			if _, err := fs.PutObjectIfMatch(&s3.PutObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("secret"),
+				Body:   strings.NewReader(body),
+			}, ""); err == nil {
+				created <- body
+			} else if err != ErrModified {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(created)
+
+	var bodies []string
+	for body := range created {
+		bodies = append(bodies, body)
+	}
+
+	if v, want := len(bodies), 1; v != want {
+		t.Errorf("Created %d objects, but expected %d: %v", v, want, bodies)
+	}
+}
+
+func TestFileStorageInterruptedPut(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	fs := &FileStorage{Root: root}
+
+	if _, err := fs.PutObject(&s3.PutObjectInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("secret"),
+		Body:     strings.NewReader("this is a test"),
+		Metadata: map[string]*string{"Sneaker-Deleted-By": aws.String("alice")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the object, but not its metadata file
+	if err := ioutil.WriteFile(filepath.Join(root, "bucket", "secret"), []byte("this is not a test"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(list.Contents), 1; v != want {
+		t.Fatalf("Listed %d objects, but expected %d", v, want)
+	}
+
+	if v, want := *list.Contents[0].ETag, `"`+fmt.Sprintf("%x", md5.Sum([]byte("this is not a test")))+`"`; v != want {
+		t.Errorf("ETag was %q, but expected %q", v, want)
+	}
+
+	head, err := fs.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(head.Metadata) != 0 {
+		t.Errorf("Metadata was %v, but expected none", head.Metadata)
+	}
+}
+
+func TestFileStorageRange(t *testing.T) {
+	root, cleanup := testDir(t)
+	defer cleanup()
+
+	fs := &FileStorage{Root: root}
+
+	if _, err := fs.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("secret"),
+		Body:   strings.NewReader("0123456789"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for rng, want := range map[string]string{
+		"bytes=2-4":   "234",
+		"bytes=8-":    "89",
+		"bytes=-3":    "789",
+		"bytes=5-100": "56789",
+		"bytes=-100":  "0123456789",
+	} {
+		resp, err := fs.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("secret"),
+			Range:  aws.String(rng),
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", rng, err)
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v := string(b); v != want {
+			t.Errorf("%s was %q, but expected %q", rng, v, want)
+		}
+
+		if v, want := aws.Int64Value(resp.ContentLength), int64(len(want)); v != want {
+			t.Errorf("%s length was %d, but expected %d", rng, v, want)
+		}
+	}
+
+	for _, rng := range []string{"bytes=10-", "bytes=4-2", "bytes=-0", "lines=1-2", "bytes=0-1,3-4"} {
+		_, err := fs.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("secret"),
+			Range:  aws.String(rng),
+		})
+		if e, ok := err.(awserr.RequestFailure); !ok || e.StatusCode() != 416 {
+			t.Errorf("%s: error was %v, but expected an invalid range", rng, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package sneaker
+
+import "os"
+
+// lockFile does nothing, so on Windows, FileStorage's writes are only
+// serialized within a single process.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,40 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testDir returns a new temporary directory, and a func which removes it.
+func testDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }
+}
+
+// testKeyring returns a Keyring with a single key, key1.
+func testKeyring(t *testing.T) *Keyring {
+	keyring := new(Keyring)
+	if err := keyring.AddKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+// testFileManager returns a Manager which stores secrets in a temporary
+// directory, encrypted with key1 of a testKeyring, and a func which removes
+// the directory.
+func testFileManager(t *testing.T) (*Manager, func()) {
+	root, cleanup := testDir(t)
+	return &Manager{
+		Objects: &FileStorage{Root: root},
+		Envelope: Envelope{
+			KMS: testKeyring(t),
+		},
+		KeyId:  "key1",
+		Bucket: "bucket",
+	}, cleanup
+}
@@ -0,0 +1,163 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	fpath "path"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// A Version is a version of a secret, as kept by S3 when versioning is enabled
+// on the bucket.
+type Version struct {
+	VersionId    string
+	LastModified time.Time
+	Size         int
+	ETag         string
+
+	// IsLatest is whether the version is the current version of the secret.
+	IsLatest bool
+
+	// DeleteMarker is whether the version records the secret's deletion, in
+	// which case it has no size, ETag, or contents.
+	DeleteMarker bool
+}
+
+// History returns the versions of the given secret, newest first. The sizes of
+// versions are read like List reads them, up to m.Concurrency at a time. If
+// versioning isn't enabled on the bucket, the only version is the latest one,
+// with a version ID of "null".
+func (m *Manager) History(path string) ([]Version, error) {
+	return m.HistoryContext(context.Background(), path)
+}
+
+// HistoryContext is like History, but stops if ctx is done.
+func (m *Manager) HistoryContext(ctx context.Context, path string) ([]Version, error) {
+	key := fpath.Join(m.Prefix, path)
+
+	var (
+		versions               []Version
+		keyMarker, nextVersion *string
+	)
+	for {
+		resp, err := m.listObjectVersions(ctx, &s3.ListObjectVersionsInput{
+			Bucket:          aws.String(m.Bucket),
+			Prefix:          aws.String(key),
+			KeyMarker:       keyMarker,
+			VersionIdMarker: nextVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// the prefix also matches secrets whose paths begin with this one
+		for _, v := range resp.Versions {
+			if aws.StringValue(v.Key) == key {
+				versions = append(versions, Version{
+					VersionId:    aws.StringValue(v.VersionId),
+					LastModified: aws.TimeValue(v.LastModified).In(time.UTC),
+					ETag:         unquote(aws.StringValue(v.ETag)),
+					IsLatest:     aws.BoolValue(v.IsLatest),
+				})
+			}
+		}
+
+		for _, d := range resp.DeleteMarkers {
+			if aws.StringValue(d.Key) == key {
+				versions = append(versions, Version{
+					VersionId:    aws.StringValue(d.VersionId),
+					LastModified: aws.TimeValue(d.LastModified).In(time.UTC),
+					IsLatest:     aws.BoolValue(d.IsLatest),
+					DeleteMarker: true,
+				})
+			}
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+
+		if resp.NextKeyMarker == nil {
+			return nil, errTruncatedListing
+		}
+		keyMarker, nextVersion = resp.NextKeyMarker, resp.NextVersionIdMarker
+	}
+
+	// the plaintext sizes of versions are only in their metadata or headers
+	var ids []string
+	index := make(map[string]int, len(versions))
+	for i, v := range versions {
+		if !v.DeleteMarker {
+			ids = append(ids, v.VersionId)
+			index[v.VersionId] = i
+		}
+	}
+
+	if err := m.each(ctx, ids, func(id string) error {
+		s, err := m.stat(ctx, key, id)
+		if err != nil {
+			return err
+		}
+		versions[index[id]].Size = s.size
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// S3 lists versions and delete markers separately
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+// DownloadVersion fetches and decrypts the given version of the secret, as
+// returned by History.
+func (m *Manager) DownloadVersion(path, versionID string) ([]byte, error) {
+	return m.DownloadVersionContext(context.Background(), path, versionID)
+}
+
+// DownloadVersionContext is like DownloadVersion, but stops if ctx is done.
+func (m *Manager) DownloadVersionContext(ctx context.Context, path, versionID string) ([]byte, error) {
+	r, err := m.open(ctx, path, versionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := io.Copy(buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Revert makes the given version of the secret its latest version. The old
+// version is re-encrypted with a new data key, under its KMS key and encryption
+// context, and uploaded, so the history of the secret is preserved.
+func (m *Manager) Revert(path, versionID string) error {
+	return m.RevertContext(context.Background(), path, versionID)
+}
+
+// RevertContext is like Revert, but stops if ctx is done.
+func (m *Manager) RevertContext(ctx context.Context, path, versionID string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+
+	r, err := m.open(ctx, path, versionID, nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return m.upload(ctx, path, r.keying, nil, nil, r, nil)
+}
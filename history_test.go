@@ -0,0 +1,220 @@
+package sneaker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestHistory(t *testing.T) {
+	fakeS3 := &FakeS3{
+		VersionsOutputs: []s3.ListObjectVersionsOutput{
+			{
+				Versions: []*s3.ObjectVersion{
+					{
+						Key:          aws.String("secrets/one"),
+						VersionId:    aws.String("v1"),
+						ETag:         aws.String(`"etag1"`),
+						Size:         aws.Int64(1004 + 224),
+						LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+					},
+					{
+						Key:          aws.String("secrets/one-more"),
+						VersionId:    aws.String("v2"),
+						IsLatest:     aws.Bool(true),
+						ETag:         aws.String(`"etag2"`),
+						Size:         aws.Int64(1005 + 224),
+						LastModified: aws.Time(time.Date(2007, 1, 2, 15, 4, 5, 0, time.UTC)),
+					},
+				},
+				DeleteMarkers: []*s3.DeleteMarkerEntry{
+					{
+						Key:          aws.String("secrets/one"),
+						VersionId:    aws.String("v3"),
+						IsLatest:     aws.Bool(true),
+						LastModified: aws.Time(time.Date(2009, 1, 2, 15, 4, 5, 0, time.UTC)),
+					},
+				},
+				IsTruncated:         aws.Bool(true),
+				NextKeyMarker:       aws.String("secrets/one"),
+				NextVersionIdMarker: aws.String("v1"),
+			},
+			{
+				Versions: []*s3.ObjectVersion{
+					{
+						Key:          aws.String("secrets/one"),
+						VersionId:    aws.String("v4"),
+						ETag:         aws.String(`"etag4"`),
+						Size:         aws.Int64(1006 + 224),
+						LastModified: aws.Time(time.Date(2008, 1, 2, 15, 4, 5, 0, time.UTC)),
+					},
+				},
+			},
+		},
+		HeadOutputs: described(File{Size: 1004}, File{Size: 1006}),
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	actual, err := man.History("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Version{
+		{
+			VersionId:    "v3",
+			LastModified: time.Date(2009, 1, 2, 15, 4, 5, 0, time.UTC),
+			IsLatest:     true,
+			DeleteMarker: true,
+		},
+		{
+			VersionId:    "v4",
+			LastModified: time.Date(2008, 1, 2, 15, 4, 5, 0, time.UTC),
+			Size:         1006,
+			ETag:         "etag4",
+		},
+		{
+			VersionId:    "v1",
+			LastModified: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			Size:         1004,
+			ETag:         "etag1",
+		},
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Was %#v\n but expected \n%#v", actual, expected)
+	}
+
+	if v, want := len(fakeS3.VersionsInputs), 2; v != want {
+		t.Fatalf("Made %d requests, but expected %d", v, want)
+	}
+
+	for i, id := range []string{"v1", "v4"} {
+		if v := aws.StringValue(fakeS3.HeadInputs[i].VersionId); v != id {
+			t.Errorf("Version was %q, but expected %q", v, id)
+		}
+	}
+
+	req := fakeS3.VersionsInputs[1]
+	if v, want := *req.Prefix, "secrets/one"; v != want {
+		t.Errorf("Prefix was %q, but expected %q", v, want)
+	}
+
+	if v, want := aws.StringValue(req.KeyMarker), "secrets/one"; v != want {
+		t.Errorf("KeyMarker was %q, but expected %q", v, want)
+	}
+
+	if v, want := aws.StringValue(req.VersionIdMarker), "v1"; v != want {
+		t.Errorf("VersionIdMarker was %q, but expected %q", v, want)
+	}
+}
+
+func TestDownloadVersion(t *testing.T) {
+	ciphertext, err := encrypt(make([]byte, 32), []byte("this is a test"), []byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext = append([]byte{
+		0x00, 0x00, 0x00, 0x0d, 0x65, 0x6e, 0x63, 0x72, 0x79, 0x70, 0x74, 0x65,
+		0x64, 0x20, 0x6b, 0x65, 0x79,
+	}, ciphertext...)
+
+	fakeS3 := &FakeS3{
+		GetOutputs: []s3.GetObjectOutput{
+			{
+				Body: ioutil.NopCloser(bytes.NewReader(ciphertext)),
+			},
+		},
+	}
+	fakeKMS := &FakeKMS{
+		DecryptOutputs: []kms.DecryptOutput{
+			{
+				KeyId:     aws.String("key1"),
+				Plaintext: make([]byte, 32),
+			},
+		},
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Envelope: Envelope{
+			KMS: fakeKMS,
+		},
+		Bucket: "bucket",
+		Prefix: "secrets",
+	}
+
+	actual, err := man.DownloadVersion("secret1.txt", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(actual), "this is a test"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+
+	getReq := fakeS3.GetInputs[0]
+	if v, want := *getReq.Key, "secrets/secret1.txt"; v != want {
+		t.Errorf("Key was %q, but expected %q", v, want)
+	}
+
+	if v, want := aws.StringValue(getReq.VersionId), "v1"; v != want {
+		t.Errorf("VersionId was %q, but expected %q", v, want)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("secret", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := man.History("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(before), 1; v != want {
+		t.Fatalf("Had %d versions, but expected %d", v, want)
+	}
+
+	if err := man.Revert("secret", before[0].VersionId); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := man.History("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after[0].ETag == before[0].ETag {
+		t.Error("Secret was not re-encrypted")
+	}
+
+	b, err := man.DownloadVersion("secret", after[0].VersionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), "hello"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+
+	if err := man.Revert("secret", "v1"); !IsNotFound(err) {
+		t.Errorf("Revert to a missing version returned %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+// Package atomicfile replaces files atomically, so readers see either their
+// old contents or their new, and never a partial write.
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// TempPrefix prefixes the names of the temporary files written while files
+// are replaced. Sneaker ignores files with it when it lists directories.
+const TempPrefix = ".sneaker-tmp-"
+
+// Write atomically replaces the named file with one with the given permissions
+// and whatever f writes to it. It's written to a temporary file in the same
+// directory, which is synced and renamed over the named file only if f
+// succeeds, and removed otherwise.
+func Write(name string, perm os.FileMode, f func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), TempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := f(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// WriteFile atomically replaces the named file with one containing the given
+// data and permissions, like Write.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	return Write(name, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,95 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(name, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), "new"; v != want {
+		t.Errorf("Contents were %q, but expected %q", v, want)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := info.Mode().Perm(), os.FileMode(0600); v != want {
+		t.Errorf("Mode was %v, but expected %v", v, want)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Errorf("Directory had %d files, but expected %d", v, want)
+	}
+}
+
+func TestWriteFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sneaker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	if err := Write(name, 0600, func(w io.Writer) error {
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return failed
+	}); err != failed {
+		t.Fatalf("Error was %v, but expected %v", err, failed)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(b), "old"; v != want {
+		t.Errorf("Contents were %q, but expected %q", v, want)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Errorf("Directory had %d files, but expected %d", v, want)
+	}
+}
@@ -0,0 +1,216 @@
+package sneaker
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/codahale/sneaker/internal/atomicfile"
+)
+
+// A Keyring is a KeyManagement implementation which doesn't use KMS. Instead,
+// data keys are wrapped with named 256-bit master keys using AES-256-GCM. As
+// with KMS, the encryption context is used as authenticated data, so a wrapped
+// data key can only be unwrapped with the context it was generated with.
+//
+// Keyrings are intended for development and testing. The master keys are only
+// as safe as the file they're stored in.
+type Keyring struct {
+	Keys map[string][]byte `json:"keys"`
+}
+
+// LoadKeyring reads a keyring from the given file.
+func LoadKeyring(name string) (*Keyring, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var k Keyring
+	if err := json.Unmarshal(b, &k); err != nil {
+		return nil, fmt.Errorf("bad keyring %s: %s", name, err)
+	}
+
+	if k.Keys == nil {
+		k.Keys = map[string][]byte{}
+	}
+
+	for id, key := range k.Keys {
+		if len(key) != keyringKeySize {
+			return nil, fmt.Errorf("bad keyring %s: key %q is %d bytes", name, id, len(key))
+		}
+	}
+
+	return &k, nil
+}
+
+// Save atomically writes the keyring to the given file, which is only readable
+// by the current user.
+func (k *Keyring) Save(name string) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(name, b, 0600)
+}
+
+// AddKey generates a new random master key with the given ID.
+func (k *Keyring) AddKey(id string) error {
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("bad key ID: %q", id)
+	}
+
+	if _, ok := k.Keys[id]; ok {
+		return fmt.Errorf("key %q already exists", id)
+	}
+
+	key := make([]byte, keyringKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	if k.Keys == nil {
+		k.Keys = map[string][]byte{}
+	}
+	k.Keys[id] = key
+	return nil
+}
+
+// KeyIDs returns the sorted IDs of the keys in the keyring.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.Keys))
+	for id := range k.Keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GenerateDataKey generates a random data key and wraps it with the requested
+// master key.
+func (k *Keyring) GenerateDataKey(req *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	id := aws.StringValue(req.KeyId)
+	master, ok := k.Keys[id]
+	if !ok {
+		return nil, awserr.New("NotFoundException", fmt.Sprintf("key %q not found", id), nil)
+	}
+
+	size := int(aws.Int64Value(req.NumberOfBytes))
+	switch aws.StringValue(req.KeySpec) {
+	case "AES_256":
+		size = 32
+	case "AES_128":
+		size = 16
+	}
+	if size <= 0 || size > 1024 {
+		return nil, awserr.New("ValidationException", "bad data key size", nil)
+	}
+
+	plaintext := make([]byte, size)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{keyringVersion, byte(len(id))}, id...)
+
+	gcm, err := keyringGCM(master)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob := append(header, nonce...)
+	blob = gcm.Seal(blob, nonce, plaintext, keyringData(header, req.EncryptionContext))
+
+	return &kms.GenerateDataKeyOutput{
+		CiphertextBlob: blob,
+		KeyId:          aws.String(id),
+		Plaintext:      plaintext,
+	}, nil
+}
+
+// Decrypt unwraps a data key generated by GenerateDataKey.
+func (k *Keyring) Decrypt(req *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	blob := req.CiphertextBlob
+	if len(blob) < 2 || blob[0] != keyringVersion || len(blob) < 2+int(blob[1]) {
+		return nil, errInvalidCiphertext
+	}
+
+	header, blob := blob[:2+int(blob[1])], blob[2+int(blob[1]):]
+	id := string(header[2:])
+
+	master, ok := k.Keys[id]
+	if !ok {
+		return nil, awserr.New("NotFoundException", fmt.Sprintf("key %q not found", id), nil)
+	}
+
+	gcm, err := keyringGCM(master)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) < gcm.NonceSize() {
+		return nil, errInvalidCiphertext
+	}
+
+	nonce, blob := blob[:gcm.NonceSize()], blob[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, blob, keyringData(header, req.EncryptionContext))
+	if err != nil {
+		return nil, errInvalidCiphertext
+	}
+
+	return &kms.DecryptOutput{
+		KeyId:     aws.String(id),
+		Plaintext: plaintext,
+	}, nil
+}
+
+func keyringGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keyringData returns the authenticated data for a wrapped key: the blob header
+// followed by the length-prefixed keys and values of the encryption context, in
+// sorted order.
+func keyringData(header []byte, ctxt map[string]*string) []byte {
+	keys := make([]string, 0, len(ctxt))
+	for k := range ctxt {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data := append([]byte(nil), header...)
+	for _, k := range keys {
+		for _, s := range []string{k, aws.StringValue(ctxt[k])} {
+			var n [4]byte
+			binary.BigEndian.PutUint32(n[:], uint32(len(s)))
+			data = append(data, n[:]...)
+			data = append(data, s...)
+		}
+	}
+	return data
+}
+
+var errInvalidCiphertext = awserr.New("InvalidCiphertextException", "invalid ciphertext", nil)
+
+const (
+	keyringVersion = 1
+	keyringKeySize = 32
+)
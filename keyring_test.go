@@ -0,0 +1,96 @@
+package sneaker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyringRoundTrip(t *testing.T) {
+	keyring := new(Keyring)
+	if err := keyring.AddKey("key1"); err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := Envelope{
+		KMS: keyring,
+	}
+
+	ctxt := map[string]string{"A": "B"}
+	ciphertext, err := envelope.Seal("key1", ctxt, []byte("this is the plaintext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := envelope.Open(ctxt, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(plaintext), "this is the plaintext"; v != want {
+		t.Errorf("Plaintext was %q, but expected %q", v, want)
+	}
+
+	if _, err := envelope.Open(map[string]string{"A": "C"}, ciphertext); err == nil {
+		t.Error("Opened with the wrong context")
+	}
+
+	if _, err := envelope.Open(nil, ciphertext); err == nil {
+		t.Error("Opened without a context")
+	}
+}
+
+func TestKeyringUnknownKey(t *testing.T) {
+	envelope := Envelope{
+		KMS: new(Keyring),
+	}
+
+	if _, err := envelope.Seal("key1", nil, []byte("this is the plaintext")); err == nil {
+		t.Error("Sealed with an unknown key")
+	}
+}
+
+func TestKeyringSaveLoad(t *testing.T) {
+	dir, cleanup := testDir(t)
+	defer cleanup()
+
+	keyring := new(Keyring)
+	for _, id := range []string{"key2", "key1"} {
+		if err := keyring.AddKey(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := keyring.AddKey("key1"); err == nil {
+		t.Error("Added a duplicate key")
+	}
+
+	name := filepath.Join(dir, "keyring")
+	if err := keyring.Save(name); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := info.Mode().Perm(), os.FileMode(0600); v != want {
+		t.Errorf("Mode was %v, but expected %v", v, want)
+	}
+
+	loaded, err := LoadKeyring(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := loaded.KeyIDs(), []string{"key1", "key2"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Key IDs were %v, but expected %v", v, want)
+	}
+
+	if v, want := loaded.Keys["key1"], keyring.Keys["key1"]; !bytes.Equal(v, want) {
+		t.Errorf("Key was %x, but expected %x", v, want)
+	}
+}
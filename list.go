@@ -1,56 +1,328 @@
 package sneaker
 
 import (
-	"path"
+	"context"
+	"errors"
+	"fmt"
+	fpath "path"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// ListOptions control what List returns about each file.
+type ListOptions struct {
+	// SkipMetadata is whether to return only each file's path, modification
+	// time, and ETag, without reading its KMS key, format, plaintext size,
+	// and digest from its metadata. That saves a request per file, but
+	// leaves Size zero.
+	SkipMetadata bool
+}
+
 // List returns a list of files which match the given pattern, or if the pattern
-// is blank, all files.
+// is blank, all files. The KMS key, format, plaintext size, and digest of each
+// file are read from its metadata, up to m.Concurrency files at a time, and
+// files deleted while they're being listed are left out.
 func (m *Manager) List(pattern string) ([]File, error) {
-	resp, err := m.Objects.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(m.Bucket),
-		Prefix: aws.String(m.Prefix),
-	})
-	if err != nil {
+	return m.ListContext(context.Background(), pattern)
+}
+
+// ListContext is like List, but stops if ctx is done.
+func (m *Manager) ListContext(ctx context.Context, pattern string) ([]File, error) {
+	return m.ListWithOptionsContext(ctx, pattern, ListOptions{})
+}
+
+// ListWithOptions is like List, but returns what the given options ask for.
+func (m *Manager) ListWithOptions(pattern string, opts ListOptions) ([]File, error) {
+	return m.ListWithOptionsContext(context.Background(), pattern, opts)
+}
+
+// ListWithOptionsContext is like ListWithOptions, but stops if ctx is done.
+func (m *Manager) ListWithOptionsContext(ctx context.Context, pattern string, opts ListOptions) ([]File, error) {
+	var secrets []File
+	if err := m.walkFiles(ctx, pattern, func(f File) error {
+		secrets = append(secrets, f)
+		return nil
+	}); err != nil {
 		return nil, err
 	}
 
-	var secrets []File
-	for _, obj := range resp.Contents {
-		secrets = append(secrets, File{
-			Path:         (*obj.Key)[len(m.Prefix):len(*obj.Key)],
-			LastModified: obj.LastModified.In(time.UTC),
-			Size:         int(*obj.Size) - 224, // header + KMS data key
-			ETag:         strings.Replace(*obj.ETag, "\"", "", -1),
-		})
+	if opts.SkipMetadata {
+		return secrets, nil
+	}
+
+	paths := make([]string, 0, len(secrets))
+	index := make(map[string]int, len(secrets))
+	for i, f := range secrets {
+		paths = append(paths, f.Path)
+		index[f.Path] = i
 	}
 
-	if pattern == "" {
+	// each file is only ever described by one goroutine
+	var (
+		mu   sync.Mutex
+		gone = map[string]bool{}
+	)
+	if err := m.each(ctx, paths, func(path string) error {
+		err := m.describe(ctx, &secrets[index[path]])
+		if IsNotFound(err) {
+			mu.Lock()
+			defer mu.Unlock()
+			gone[path] = true
+			return nil
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(gone) == 0 {
 		return secrets, nil
 	}
 
-	var matched []File
+	described := make([]File, 0, len(secrets)-len(gone))
 	for _, f := range secrets {
-		ok, err := match(pattern, f.Path)
-		if err != nil {
+		if !gone[f.Path] {
+			described = append(described, f)
+		}
+	}
+	return described, nil
+}
+
+// Walk calls fn for each file which matches the given pattern, or if the
+// pattern is blank, all files. Unlike List, it fetches the listing one page at
+// a time, and describes one file at a time, so it can be used with arbitrarily
+// large prefixes. If fn returns an error, Walk stops and returns that error.
+func (m *Manager) Walk(pattern string, fn func(File) error) error {
+	return m.WalkContext(context.Background(), pattern, fn)
+}
+
+// WalkContext is like Walk, but stops if ctx is done.
+func (m *Manager) WalkContext(ctx context.Context, pattern string, fn func(File) error) error {
+	return m.WalkWithOptionsContext(ctx, pattern, ListOptions{}, fn)
+}
+
+// WalkWithOptions is like Walk, but gives what the given options ask for.
+func (m *Manager) WalkWithOptions(pattern string, opts ListOptions, fn func(File) error) error {
+	return m.WalkWithOptionsContext(context.Background(), pattern, opts, fn)
+}
+
+// WalkWithOptionsContext is like WalkWithOptions, but stops if ctx is done.
+func (m *Manager) WalkWithOptionsContext(ctx context.Context, pattern string, opts ListOptions, fn func(File) error) error {
+	if opts.SkipMetadata {
+		return m.walkFiles(ctx, pattern, fn)
+	}
+
+	return m.walkFiles(ctx, pattern, func(f File) error {
+		if err := m.describe(ctx, &f); err != nil {
+			if IsNotFound(err) {
+				return nil // deleted since it was listed
+			}
+			return err
+		}
+		return fn(f)
+	})
+}
+
+// paths returns the paths of the secrets which match the given pattern,
+// without fetching their metadata.
+func (m *Manager) paths(ctx context.Context, pattern string) ([]string, error) {
+	var paths []string
+	if err := m.walkFiles(ctx, pattern, func(f File) error {
+		paths = append(paths, f.Path)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// describe fills in the KMS key, format, plaintext size, and digest of the
+// given file.
+func (m *Manager) describe(ctx context.Context, f *File) error {
+	s, err := m.stat(ctx, fpath.Join(m.Prefix, f.Path), "")
+	if err != nil {
+		return err
+	}
+
+	f.KeyId, f.FormatVersion, f.Size, f.Digest = s.keyID, s.format, s.size, s.digest
+	return nil
+}
+
+// An objectStat is what's known about a stored secret without decrypting it.
+type objectStat struct {
+	keyID    string
+	format   int
+	size     int               // the size of the plaintext
+	digest   string            // the keyed digest of the plaintext, if recorded
+	ctxt     map[string]string // the encryption context, or nil if not recorded
+	metadata map[string]*string
+}
+
+// stat returns the KMS key, format, and plaintext size of the given version of
+// the object with the given key, or if the version ID is blank, the latest
+// version. They're read from its metadata, or for objects uploaded before they
+// were recorded, calculated from its header, which is fetched with a ranged
+// GET. Objects whose headers can't be read aren't secrets, so their plaintext
+// is the whole object.
+func (m *Manager) stat(ctx context.Context, key, versionID string) (*objectStat, error) {
+	var version *string
+	if versionID != "" {
+		version = aws.String(versionID)
+	}
+
+	resp, err := m.headObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(m.Bucket),
+		Key:       aws.String(key),
+		VersionId: version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the unkeyed Sneaker-Digest recorded by earlier versions is ignored, as
+	// it reveals low-entropy plaintexts to anyone who can read metadata; it's
+	// dropped when the secret is re-encrypted, since upload only keeps the
+	// metadata it's given
+	s := &objectStat{metadata: resp.Metadata, digest: metadata(resp.Metadata, metaDigest)}
+	if c := metadata(resp.Metadata, metaContext); c != "" {
+		if s.ctxt, err = decodeContext(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if format, size := metadata(resp.Metadata, metaFormat), metadata(resp.Metadata, metaSize); format != "" && size != "" {
+		s.keyID = metadata(resp.Metadata, metaKeyID)
+		if s.format, err = strconv.Atoi(format); err != nil {
 			return nil, err
 		}
 
-		if ok {
-			matched = append(matched, f)
+		if s.size, err = strconv.Atoi(size); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	obj, err := m.getObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(m.Bucket),
+		Key:       aws.String(key),
+		VersionId: version,
+		Range:     aws.String(fmt.Sprintf("bytes=0-%d", maxHeaderPeek-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	h, err := ReadHeader(obj.Body)
+	if err != nil {
+		// not a secret, or its header is unusually large
+		s.size = int(aws.Int64Value(resp.ContentLength))
+		return s, nil
+	}
+
+	s.format = h.Version
+	s.keyID = h.KeyID
+	if h.Version == 0 {
+		s.keyID = kmsKeyARN(h.DataKey)
+	}
+	s.size = int(plaintextSize(h, aws.Int64Value(resp.ContentLength)))
+	return s, nil
+}
+
+// kmsKeyARN returns the ARN of the KMS key embedded in the given encrypted data
+// key, or a blank string if one can't be found. KMS doesn't document the
+// format of encrypted data keys, but they include the ARN of the key.
+func kmsKeyARN(blob []byte) string {
+	return string(kmsKeyARNPattern.Find(blob))
+}
+
+// walkFiles calls fn for each file which matches the given pattern, without
+// fetching their metadata.
+func (m *Manager) walkFiles(ctx context.Context, pattern string, fn func(File) error) error {
+	return m.walkTree(ctx, "", func(f File) error {
+		if pattern != "" {
+			ok, err := match(pattern, f.Path)
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				return nil
+			}
+		}
+
+		return fn(f)
+	})
+}
+
+// walkTree calls fn for each file in the given directory and its
+// subdirectories (e.g. db for db/password and db/prod/password), or if the
+// directory is blank, all files, without fetching their metadata.
+func (m *Manager) walkTree(ctx context.Context, dir string, fn func(File) error) error {
+	prefix := m.Prefix
+	if dir != "" {
+		prefix = fpath.Join(m.Prefix, dir) + "/"
+	}
+
+	return m.walk(ctx, prefix, func(obj *s3.Object) error {
+		f := File{
+			Path:         (*obj.Key)[len(m.Prefix):len(*obj.Key)],
+			LastModified: obj.LastModified.In(time.UTC),
+			ETag:         unquote(*obj.ETag),
+		}
+
+		if reserved(f.Path) {
+			return nil
+		}
+		return fn(f)
+	})
+}
+
+// walk calls fn for each object whose key begins with the given prefix.
+func (m *Manager) walk(ctx context.Context, prefix string, fn func(*s3.Object) error) error {
+	var marker *string
+	for {
+		resp, err := m.listObjects(ctx, &s3.ListObjectsInput{
+			Bucket: aws.String(m.Bucket),
+			Prefix: aws.String(prefix),
+			Marker: marker,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range resp.Contents {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			return nil
+		}
+
+		// S3 only returns NextMarker if a delimiter was specified, otherwise the
+		// last key of the page is the marker for the next one.
+		switch {
+		case resp.NextMarker != nil:
+			marker = resp.NextMarker
+		case len(resp.Contents) > 0:
+			marker = resp.Contents[len(resp.Contents)-1].Key
+		default:
+			return errTruncatedListing
 		}
 	}
-	return matched, nil
 }
 
 func match(pattern, name string) (bool, error) {
 	for _, s := range strings.Split(pattern, ",") {
-		m, err := path.Match(s, name)
+		m, err := fpath.Match(s, name)
 		if err != nil {
 			return false, err
 		}
@@ -61,3 +333,15 @@ func match(pattern, name string) (bool, error) {
 	}
 	return false, nil
 }
+
+var (
+	errTruncatedListing = errors.New("truncated listing without a marker")
+
+	kmsKeyARNPattern = regexp.MustCompile(`arn:aws[a-z-]*:kms:[a-z0-9-]+:[0-9]{12}:key/[0-9a-f-]{36}`)
+)
+
+const (
+	// maxHeaderPeek is the number of bytes of a secret fetched to read the
+	// header of a secret uploaded without metadata.
+	maxHeaderPeek = 4096
+)
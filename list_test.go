@@ -1,11 +1,16 @@
 package sneaker
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
@@ -37,6 +42,7 @@ func TestListPattern(t *testing.T) {
 				},
 			},
 		},
+		HeadOutputs: described(File{KeyId: "key1", Size: 1004}, File{KeyId: "key2", Size: 1005}),
 	}
 
 	man := Manager{
@@ -52,16 +58,20 @@ func TestListPattern(t *testing.T) {
 
 	expected := []File{
 		File{
-			Path:         "one",
-			LastModified: time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC),
-			Size:         1004,
-			ETag:         "etag1",
+			Path:          "one",
+			LastModified:  time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC),
+			Size:          1004,
+			ETag:          "etag1",
+			KeyId:         "key1",
+			FormatVersion: 1,
 		},
 		File{
-			Path:         "two",
-			LastModified: time.Date(2007, 1, 2, 16, 4, 5, 0, time.UTC),
-			Size:         1005,
-			ETag:         "etag2",
+			Path:          "two",
+			LastModified:  time.Date(2007, 1, 2, 16, 4, 5, 0, time.UTC),
+			Size:          1005,
+			ETag:          "etag2",
+			KeyId:         "key2",
+			FormatVersion: 1,
 		},
 	}
 
@@ -108,6 +118,11 @@ func TestListNoPattern(t *testing.T) {
 				},
 			},
 		},
+		HeadOutputs: described(
+			File{KeyId: "key1", Size: 1004},
+			File{KeyId: "key1", Size: 1005},
+			File{KeyId: "key1", Size: 1006},
+		),
 	}
 
 	man := Manager{
@@ -123,22 +138,28 @@ func TestListNoPattern(t *testing.T) {
 
 	expected := []File{
 		File{
-			Path:         "one",
-			LastModified: time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC),
-			Size:         1004,
-			ETag:         "etag1",
+			Path:          "one",
+			LastModified:  time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC),
+			Size:          1004,
+			ETag:          "etag1",
+			KeyId:         "key1",
+			FormatVersion: 1,
 		},
 		File{
-			Path:         "two",
-			LastModified: time.Date(2007, 1, 2, 16, 4, 5, 0, time.UTC),
-			Size:         1005,
-			ETag:         "etag2",
+			Path:          "two",
+			LastModified:  time.Date(2007, 1, 2, 16, 4, 5, 0, time.UTC),
+			Size:          1005,
+			ETag:          "etag2",
+			KeyId:         "key1",
+			FormatVersion: 1,
 		},
 		File{
-			Path:         "winkle",
-			LastModified: time.Date(2008, 1, 2, 16, 4, 5, 0, time.UTC),
-			Size:         1006,
-			ETag:         "etag3",
+			Path:          "winkle",
+			LastModified:  time.Date(2008, 1, 2, 16, 4, 5, 0, time.UTC),
+			Size:          1006,
+			ETag:          "etag3",
+			KeyId:         "key1",
+			FormatVersion: 1,
 		},
 	}
 
@@ -156,3 +177,299 @@ func TestListNoPattern(t *testing.T) {
 		t.Errorf("Prefix was %q but expected %q", v, want)
 	}
 }
+
+func TestListPaginated(t *testing.T) {
+	var objects []*s3.Object
+	for _, name := range []string{"one", "three", "two", "winkle", "zed"} {
+		objects = append(objects, &s3.Object{
+			Key:          aws.String("secrets/" + name),
+			ETag:         aws.String(`"etag-` + name + `"`),
+			Size:         aws.Int64(1000 + 224),
+			LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+		})
+	}
+
+	fakeS3 := &FakeS3{
+		ListOutputs: paginate(objects, 2),
+		HeadOutputs: described(File{KeyId: "key1"}, File{KeyId: "key1"}, File{KeyId: "key1"}),
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	actual, err := man.List("t*,z*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range actual {
+		paths = append(paths, f.Path)
+	}
+
+	if v, want := paths, []string{"three", "two", "zed"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Paths were %v, but expected %v", v, want)
+	}
+
+	if v, want := len(fakeS3.ListInputs), 3; v != want {
+		t.Fatalf("Made %d list requests, but expected %d", v, want)
+	}
+
+	if v := fakeS3.ListInputs[0].Marker; v != nil {
+		t.Errorf("First marker was %q, but expected none", *v)
+	}
+
+	if v, want := *fakeS3.ListInputs[1].Marker, "secrets/three"; v != want {
+		t.Errorf("Second marker was %q, but expected %q", v, want)
+	}
+
+	if v, want := *fakeS3.ListInputs[2].Marker, "secrets/winkle"; v != want {
+		t.Errorf("Third marker was %q, but expected %q", v, want)
+	}
+}
+
+func TestListNextMarker(t *testing.T) {
+	fakeS3 := &FakeS3{
+		ListOutputs: []s3.ListObjectsOutput{
+			{
+				Contents: []*s3.Object{
+					{
+						Key:          aws.String("secrets/one"),
+						ETag:         aws.String(`"etag1"`),
+						Size:         aws.Int64(1004 + 224),
+						LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+					},
+				},
+				IsTruncated: aws.Bool(true),
+				NextMarker:  aws.String("secrets/one-and-a-half"),
+			},
+			{
+				IsTruncated: aws.Bool(false),
+			},
+		},
+		HeadOutputs: described(File{KeyId: "key1"}),
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	if _, err := man.List(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := *fakeS3.ListInputs[1].Marker, "secrets/one-and-a-half"; v != want {
+		t.Errorf("Marker was %q, but expected %q", v, want)
+	}
+}
+
+func TestWalkStop(t *testing.T) {
+	var objects []*s3.Object
+	for _, name := range []string{"one", "two", "three"} {
+		objects = append(objects, &s3.Object{
+			Key:          aws.String("secrets/" + name),
+			ETag:         aws.String(`"etag-` + name + `"`),
+			Size:         aws.Int64(1000 + 224),
+			LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+		})
+	}
+
+	fakeS3 := &FakeS3{
+		ListOutputs: paginate(objects, 1),
+		HeadOutputs: described(File{KeyId: "key1"}, File{KeyId: "key1"}),
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	stop := errors.New("stop")
+	var seen []string
+	err := man.Walk("", func(f File) error {
+		seen = append(seen, f.Path)
+		if f.Path == "two" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Error was %v, but expected %v", err, stop)
+	}
+
+	if v, want := seen, []string{"one", "two"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Walked %v, but expected %v", v, want)
+	}
+
+	if v, want := len(fakeS3.ListInputs), 2; v != want {
+		t.Errorf("Made %d list requests, but expected %d", v, want)
+	}
+}
+
+func TestListLegacy(t *testing.T) {
+	arn := "arn:aws:kms:us-west-2:123456789012:key/b0f5d9a1-7e4c-4b8e-9a36-1c2d3e4f5a6b"
+	blob := append(append([]byte{0x01, 0x02, 0x02, 0x00, 0x78}, arn...), 0xde, 0xad)
+
+	v0 := append([]byte{0, 0, 0, byte(len(blob))}, blob...)
+	v1 := append([]byte("SNKR\x01\x02\x00\x04key1\x00\x00\x00\x04"), "blob"...)
+
+	var objects []*s3.Object
+	for _, name := range []string{"one", "three", "two"} {
+		objects = append(objects, &s3.Object{
+			Key:          aws.String("secrets/" + name),
+			ETag:         aws.String(`"etag-` + name + `"`),
+			Size:         aws.Int64(1000 + 224),
+			LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+		})
+	}
+
+	fakeS3 := &FakeS3{
+		ListOutputs: paginate(objects, 3),
+		HeadOutputs: []s3.HeadObjectOutput{
+			{ContentLength: aws.Int64(1224)},
+			{ContentLength: aws.Int64(1224)},
+			{ContentLength: aws.Int64(1224)},
+		},
+		GetOutputs: []s3.GetObjectOutput{
+			{Body: ioutil.NopCloser(bytes.NewReader(v0))},
+			{Body: ioutil.NopCloser(bytes.NewReader(v1))},
+			{Body: ioutil.NopCloser(strings.NewReader("SNKR\x09"))},
+		},
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []struct {
+		keyID   string
+		version int
+		size    int
+	}{
+		{arn, 0, 1224 - 4 - len(blob) - 12 - 16},
+		{"key1", 1, 1224 - len(v1) - 16},
+		{"", 0, 1224}, // not a secret
+	} {
+		if v := files[i].KeyId; v != want.keyID {
+			t.Errorf("%s key was %q, but expected %q", files[i].Path, v, want.keyID)
+		}
+
+		if v := files[i].FormatVersion; v != want.version {
+			t.Errorf("%s format was %d, but expected %d", files[i].Path, v, want.version)
+		}
+
+		if v := files[i].Size; v != want.size {
+			t.Errorf("%s size was %d, but expected %d", files[i].Path, v, want.size)
+		}
+	}
+
+	if v, want := aws.StringValue(fakeS3.GetInputs[0].Range), "bytes=0-4095"; v != want {
+		t.Errorf("Range was %q, but expected %q", v, want)
+	}
+}
+
+func TestListDeleted(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"one", "two"} {
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// "one" is deleted after it's listed, but before it's described
+	man.Objects = &deletedStorage{ObjectStorage: man.Objects, key: "one"}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Fatalf("Listed %d files, but expected %d", v, want)
+	}
+
+	if v, want := files[0].Path, "two"; v != want {
+		t.Errorf("Path was %q, but expected %q", v, want)
+	}
+
+	if v, want := files[0].Size, 3; v != want {
+		t.Errorf("Size was %d, but expected %d", v, want)
+	}
+}
+
+func TestListSkipMetadata(t *testing.T) {
+	var objects []*s3.Object
+	for _, name := range []string{"one", "three", "two"} {
+		objects = append(objects, &s3.Object{
+			Key:          aws.String("secrets/" + name),
+			ETag:         aws.String(`"etag-` + name + `"`),
+			Size:         aws.Int64(1000 + 224),
+			LastModified: aws.Time(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+		})
+	}
+
+	fakeS3 := &FakeS3{
+		ListOutputs: paginate(objects, 2),
+	}
+
+	man := Manager{
+		Objects: fakeS3,
+		Bucket:  "bucket",
+		Prefix:  "secrets/",
+	}
+
+	files, err := man.ListWithOptions("t*", ListOptions{SkipMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []File{
+		{
+			Path:         "three",
+			LastModified: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			ETag:         "etag-three",
+		},
+		{
+			Path:         "two",
+			LastModified: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			ETag:         "etag-two",
+		},
+	}
+
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Was %#v\n but expected \n%#v", files, expected)
+	}
+
+	if v := len(fakeS3.HeadInputs); v != 0 {
+		t.Errorf("Made %d head requests, but expected none", v)
+	}
+}
+
+// deletedStorage reports the object with the given key as not found, except
+// in listings.
+type deletedStorage struct {
+	ObjectStorage
+	key string
+}
+
+func (s *deletedStorage) HeadObject(req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if aws.StringValue(req.Key) == s.key {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "")
+	}
+	return s.ObjectStorage.HeadObject(req)
+}
@@ -0,0 +1,134 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+)
+
+// manifestName is the name of the manifest entry in packs. Secrets can't be
+// packed with it as their path.
+const manifestName = fsReserved + "manifest.json"
+
+// maxManifestSize is the largest manifest which will be read from a pack.
+const maxManifestSize = 64 << 20
+
+// A Manifest describes the contents of a pack. It's the first entry in the
+// pack's TAR file, and is encrypted along with the secrets.
+type Manifest struct {
+	PackedAt time.Time       `json:"packed_at"`
+	KeyID    string          `json:"key_id"`
+	Entries  []ManifestEntry `json:"entries"`
+}
+
+// A ManifestEntry describes a secret in a pack.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// ETag is the ETag of the secret's S3 object, if it was packed from S3.
+	ETag string `json:"etag,omitempty"`
+}
+
+// ReadManifest decrypts a pack written by Pack using KMS and the given context,
+// and returns its manifest. Only as much of the pack as the manifest takes up
+// is decrypted.
+//
+// Packs written before packs had manifests are read in full, and their
+// manifests only have the paths and sizes of their secrets.
+func (m *Manager) ReadManifest(ctxt map[string]string, r io.Reader) (*Manifest, error) {
+	return m.ReadManifestContext(context.Background(), ctxt, r)
+}
+
+// ReadManifestContext is like ReadManifest, but stops if ctx is done.
+func (m *Manager) ReadManifestContext(ctx context.Context, ctxt map[string]string, r io.Reader) (*Manifest, error) {
+	ur, err := m.UnpackContext(ctx, ctxt, r)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(ur)
+	manifest, hdr, err := readManifest(tr)
+	if err != nil || manifest != nil {
+		return manifest, err
+	}
+
+	manifest = &Manifest{}
+	for hdr != nil {
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			manifest.Entries = append(manifest.Entries, ManifestEntry{
+				Path: path.Clean(hdr.Name),
+				Size: hdr.Size,
+			})
+		}
+
+		if hdr, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// readManifest reads the manifest from the start of the given TAR file. If the
+// pack doesn't have one, it returns a nil manifest and the header of the first
+// entry, whose contents have yet to be read, or nil if the TAR file is empty.
+func readManifest(tr *tar.Reader) (*Manifest, *tar.Header, error) {
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if path.Clean(hdr.Name) != manifestName {
+		return nil, hdr, nil
+	}
+
+	if hdr.Size > maxManifestSize {
+		return nil, nil, fmt.Errorf("manifest is too large: %d bytes", hdr.Size)
+	}
+
+	b, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	return &manifest, nil, nil
+}
+
+// entries returns the manifest's entries by their cleaned paths.
+func (mf *Manifest) entries() map[string]ManifestEntry {
+	entries := make(map[string]ManifestEntry, len(mf.Entries))
+	for _, e := range mf.Entries {
+		entries[path.Clean(e.Path)] = e
+	}
+	return entries
+}
+
+// sha256Hex returns the hex-encoded digest of everything written to h.
+func sha256Hex(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sortEntries sorts the given manifest entries by path.
+func sortEntries(entries []ManifestEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
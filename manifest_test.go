@@ -0,0 +1,125 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadManifest(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for path, secret := range map[string]string{
+		"db/password": "hunter2",
+		"api.key":     "key",
+	} {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := time.Now().Add(-time.Second)
+
+	buf := bytes.NewBuffer(nil)
+	if err := man.PackPaths([]string{"db/password", "api.key"}, nil, "", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := man.ReadManifest(nil, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := manifest.PackedAt; v.Before(before) || v.After(time.Now()) {
+		t.Errorf("Packing time was %v, but expected around %v", v, before)
+	}
+
+	if v, want := manifest.KeyID, "key1"; v != want {
+		t.Errorf("Key ID was %q, but expected %q", v, want)
+	}
+
+	expected := []ManifestEntry{
+		{
+			Path:   "db/password",
+			Size:   7,
+			SHA256: "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7",
+		},
+		{
+			Path:   "api.key",
+			Size:   3,
+			SHA256: "2c70e12b7a0646f92279f427c7b38e7334d8e5389cff167a1dc30e73f826b683",
+		},
+	}
+
+	for i, e := range manifest.Entries {
+		if e.ETag == "" {
+			t.Errorf("%s had no ETag", e.Path)
+		}
+		manifest.Entries[i].ETag = ""
+	}
+
+	if v, want := manifest.Entries, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Entries were %#v, but expected %#v", v, want)
+	}
+}
+
+func TestReadManifestLegacy(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	buf := sealTar(t, man, func(tw *tar.Writer) {
+		if err := packFile(tw, "db/password", 7, strings.NewReader("hunter2")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	manifest, err := man.ReadManifest(nil, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Manifest{
+		Entries: []ManifestEntry{
+			{Path: "db/password", Size: 7},
+		},
+	}
+
+	if v, want := manifest, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Manifest was %#v, but expected %#v", v, want)
+	}
+}
+
+func TestPackReservedPath(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	secrets := map[string][]byte{manifestName: []byte("nope")}
+	if err := man.Pack(secrets, nil, "", bytes.NewBuffer(nil)); err == nil {
+		t.Error("Packed a secret at the manifest's path")
+	}
+}
+
+// sealTar encrypts a TAR file written by f, without a manifest.
+func sealTar(t *testing.T, man *Manager, f func(*tar.Writer)) *bytes.Buffer {
+	buf := bytes.NewBuffer(nil)
+	w, err := man.Envelope.SealWriter(man.KeyId, nil, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tw := tar.NewWriter(w)
+	f(tw)
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
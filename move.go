@@ -0,0 +1,96 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Copy copies the given secret to a new path. Because a secret's path is part
+// of its encryption context, the secret can't simply be copied in S3; instead,
+// it's decrypted and re-encrypted with a new data key for the new path, under
+// the same KMS key and encryption context. The copy is then downloaded and
+// compared with the original.
+//
+// If a secret already exists at the new path, ErrExists is returned, unless
+// force is true, in which case it's moved to the trash, like Rm moves it, and
+// replaced. The new path is checked like UploadIfMatch checks it.
+func (m *Manager) Copy(src, dst string, force bool) error {
+	return m.CopyContext(context.Background(), src, dst, force)
+}
+
+// CopyContext is like Copy, but stops if ctx is done.
+func (m *Manager) CopyContext(ctx context.Context, src, dst string, force bool) error {
+	for _, path := range []string{src, dst} {
+		if err := checkPath(path); err != nil {
+			return err
+		}
+	}
+
+	if src == dst {
+		return fmt.Errorf("can't copy %s to itself", src)
+	}
+
+	r, err := m.open(ctx, src, "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if force {
+		if err := m.trash(ctx, dst); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	// even when forced, the copy only replaces the secret which was trashed
+	h := sha256.New()
+	if err := m.upload(ctx, dst, r.keying, nil, nil, io.TeeReader(r, h), aws.String("")); err != nil {
+		if err == ErrModified {
+			return ErrExists
+		}
+		return err
+	}
+
+	return m.verify(ctx, dst, h.Sum(nil))
+}
+
+// Move is like Copy, but moves the original secret to the trash, like Rm moves
+// it, once the copy has been verified. If the copy can't be verified, the
+// original secret is left in place.
+func (m *Manager) Move(src, dst string, force bool) error {
+	return m.MoveContext(context.Background(), src, dst, force)
+}
+
+// MoveContext is like Move, but stops if ctx is done.
+func (m *Manager) MoveContext(ctx context.Context, src, dst string, force bool) error {
+	if err := m.CopyContext(ctx, src, dst, force); err != nil {
+		return err
+	}
+
+	return m.trash(ctx, src)
+}
+
+// verify downloads and decrypts the given secret, and checks that the SHA-256
+// hash of its plaintext is the given hash.
+func (m *Manager) verify(ctx context.Context, path string, digest []byte) error {
+	r, err := m.open(ctx, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return fmt.Errorf("%s was modified after it was uploaded", path)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package sneaker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestCopy(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("staging/db", strings.NewReader("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Copy("staging/db", "prod/db", false); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := man.Download([]string{"staging/db", "prod/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, secret := range secrets {
+		if v, want := string(secret), "password"; v != want {
+			t.Errorf("%s was %q, but expected %q", path, v, want)
+		}
+	}
+
+	if err := man.Copy("prod/db", "prod/db", true); err == nil {
+		t.Error("Copied a secret to itself")
+	}
+
+	if err := man.Copy("prod/db", ".trash/db", false); err != ErrReservedPath {
+		t.Errorf("Error was %v, but expected %v", err, ErrReservedPath)
+	}
+
+	for _, path := range []string{"./prod/db", "x/../.trash/db", "../db", "/db", "prod/db/"} {
+		if err := man.Copy("prod/db", path, false); err != ErrInvalidPath {
+			t.Errorf("%s: error was %v, but expected %v", path, err, ErrInvalidPath)
+		}
+	}
+}
+
+func TestCopyExisting(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"staging/db", "prod/db"} {
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := man.Move("staging/db", "prod/db", false); err != ErrExists {
+		t.Errorf("Error was %v, but expected %v", err, ErrExists)
+	}
+
+	secrets, err := man.Download([]string{"staging/db", "prod/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, secret := range secrets {
+		if v, want := string(secret), path; v != want {
+			t.Errorf("%s was %q, but expected %q", path, v, want)
+		}
+	}
+
+	if err := man.Copy("staging/db", "prod/db", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := download(t, man, "prod/db"), "staging/db"; v != want {
+		t.Errorf("Copy was %q, but expected %q", v, want)
+	}
+
+	// the replaced secret is in the trash
+	trash, err := man.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(trash), 1; v != want {
+		t.Fatalf("Trashed %d secrets, but expected %d", v, want)
+	}
+
+	if v, want := trash[0].Path, "prod/db"; v != want {
+		t.Errorf("Trashed %q, but expected %q", v, want)
+	}
+}
+
+func TestMove(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("staging/db", strings.NewReader("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Move("staging/db", "prod/db", false); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 1; v != want {
+		t.Fatalf("Had %d secrets, but expected %d", v, want)
+	}
+
+	if v, want := files[0].Path, "prod/db"; v != want {
+		t.Errorf("Path was %q, but expected %q", v, want)
+	}
+
+	secrets, err := man.Download([]string{"prod/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(secrets["prod/db"]), "password"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+
+	// the original is in the trash
+	if err := man.Undelete("staging/db"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := download(t, man, "staging/db"), "password"; v != want {
+		t.Errorf("Undeleted secret was %q, but expected %q", v, want)
+	}
+}
+
+func TestMoveUnverified(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("staging/db", strings.NewReader("staging/db")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy is never stored, so it can't be read back
+	man.Objects = &droppingStorage{FileStorage: man.Objects.(*FileStorage), key: "prod/db"}
+
+	if err := man.Move("staging/db", "prod/db", false); err == nil {
+		t.Fatal("Move succeeded, but the copy wasn't stored")
+	}
+
+	secrets, err := man.Download([]string{"staging/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(secrets["staging/db"]), "staging/db"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+}
+
+// droppingStorage pretends to store objects with the given key, but doesn't.
+type droppingStorage struct {
+	*FileStorage
+	key string
+}
+
+func (s *droppingStorage) PutObject(req *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if aws.StringValue(req.Key) == s.key {
+		return &s3.PutObjectOutput{}, nil
+	}
+	return s.FileStorage.PutObject(req)
+}
+
+func (s *droppingStorage) PutObjectIfMatch(req *s3.PutObjectInput, etag string) (*s3.PutObjectOutput, error) {
+	if aws.StringValue(req.Key) == s.key {
+		return &s3.PutObjectOutput{}, nil
+	}
+	return s.FileStorage.PutObjectIfMatch(req, etag)
+}
@@ -2,49 +2,254 @@ package sneaker
 
 import (
 	"archive/tar"
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"path"
+	"sync"
 	"time"
 )
 
 // Pack puts the given secrets into a TAR file and encrypts that with a new KMS
-// data key with the context. The result is written into the given writer.
+// data key with the context. The result is written into the given writer. The
+// first entry in the TAR file is a Manifest of the secrets, which can be read
+// with ReadManifest.
 func (m *Manager) Pack(secrets map[string][]byte, ctxt map[string]string, keyID string, w io.Writer) error {
-	if keyID == "" {
-		keyID = m.KeyId
-	}
+	return m.PackContext(context.Background(), secrets, ctxt, keyID, w)
+}
 
-	buf := bytes.NewBuffer(nil)
-	tw := tar.NewWriter(buf)
+// PackContext is like Pack, but stops if ctx is done.
+func (m *Manager) PackContext(ctx context.Context, secrets map[string][]byte, ctxt map[string]string, keyID string, w io.Writer) error {
+	entries := make([]ManifestEntry, 0, len(secrets))
 	for filename, data := range secrets {
-		if err := tw.WriteHeader(&tar.Header{
-			Size:       int64(len(data)),
-			Uname:      "root",
-			Gname:      "root",
-			Name:       path.Join(".", filename),
-			Mode:       0400,
-			ModTime:    time.Now(),
-			AccessTime: time.Now(),
-			ChangeTime: time.Now(),
-		}); err != nil {
-			return err
+		sum := sha256.Sum256(data)
+		entries = append(entries, ManifestEntry{
+			Path:   filename,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	sortEntries(entries)
+
+	return m.pack(ctx, ctxt, keyID, w, entries, func(tw *tar.Writer) error {
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			data := secrets[e.Path]
+			if err := packFile(tw, e.Path, e.Size, bytes.NewReader(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PackPaths is like Pack, but fetches the given secrets itself. Each secret is
+// decrypted and re-encrypted as it's read, so secrets of any size can be packed
+// in bounded memory.
+//
+// Because the manifest comes first, the secrets are read once, up to
+// m.Concurrency at a time, into temporary files, encrypted with random keys
+// which are only kept in memory, then packed from those. If any secrets can't
+// be read, the error is a PathErrors.
+func (m *Manager) PackPaths(paths []string, ctxt map[string]string, keyID string, w io.Writer) error {
+	return m.PackPathsContext(context.Background(), paths, ctxt, keyID, w)
+}
+
+// PackPathsContext is like PackPaths, but stops if ctx is done.
+func (m *Manager) PackPathsContext(ctx context.Context, paths []string, ctxt map[string]string, keyID string, w io.Writer) error {
+	var (
+		mu      sync.Mutex
+		spooled = make(map[string]*spool, len(paths))
+	)
+
+	defer func() {
+		for _, s := range spooled {
+			s.remove()
 		}
+	}()
 
-		if _, err := tw.Write(data); err != nil {
+	if err := m.each(ctx, paths, func(p string) error {
+		s, err := m.spoolPath(ctx, p)
+		if err != nil {
 			return err
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		spooled[p] = s
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	entries := make([]ManifestEntry, 0, len(spooled))
+	for _, p := range paths {
+		if s, ok := spooled[p]; ok {
+			entries = append(entries, s.entry)
+		}
 	}
 
-	if err := tw.Close(); err != nil {
+	return m.pack(ctx, ctxt, keyID, w, entries, func(tw *tar.Writer) error {
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := spooled[e.Path].pack(tw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// spool is a secret read into a temporary file, encrypted with a random key
+// which is never written down.
+type spool struct {
+	name  string
+	gcm   cipher.AEAD
+	entry ManifestEntry
+}
+
+// spoolPath reads the given secret into a spool, digesting it on the way.
+func (m *Manager) spoolPath(ctx context.Context, p string) (*spool, error) {
+	r, err := m.open(ctx, p, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	key := make([]byte, 32)
+	defer zero(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile("", "sneaker")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &spool{name: f.Name(), gcm: gcm}
+	sw := &streamWriter{w: f, gcm: gcm, buf: make([]byte, 0, streamChunkSize)}
+	h := sha256.New()
+
+	n, err := io.Copy(sw, io.TeeReader(&contextReader{ctx: ctx, r: r}, h))
+	if err == nil {
+		err = sw.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		s.remove()
+		return nil, err
+	}
+
+	s.entry = ManifestEntry{
+		Path:   p,
+		Size:   n,
+		SHA256: sha256Hex(h),
+		ETag:   r.etag,
+	}
+	return s, nil
+}
+
+// pack decrypts the spooled secret into the TAR file.
+func (s *spool) pack(tw *tar.Writer) error {
+	f, err := os.Open(s.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return packFile(tw, s.entry.Path, s.entry.Size, &streamReader{
+		r:   bufio.NewReader(f),
+		gcm: s.gcm,
+		buf: make([]byte, streamChunkSize+streamOverhead),
+	})
+}
+
+// remove deletes the spool's temporary file.
+func (s *spool) remove() {
+	os.Remove(s.name)
+}
+
+func (m *Manager) pack(ctx context.Context, ctxt map[string]string, keyID string, w io.Writer, entries []ManifestEntry, f func(*tar.Writer) error) error {
+	if keyID == "" {
+		keyID = m.KeyId
+	}
+
+	for _, e := range entries {
+		if path.Join(".", e.Path) == manifestName {
+			return fmt.Errorf("%s is reserved for the manifest", e.Path)
+		}
+	}
+
+	sw, header, err := m.Envelope.sealWriter(ctx, keyID, ctxt, w)
+	if err != nil {
 		return err
 	}
 
-	ciphertext, err := m.Envelope.Seal(keyID, ctxt, buf.Bytes())
+	manifest, err := json.Marshal(&Manifest{
+		PackedAt: time.Now().UTC(),
+		KeyID:    header.KeyID,
+		Entries:  entries,
+	})
 	if err != nil {
 		return err
 	}
 
-	_, err = w.Write(ciphertext)
+	tw := tar.NewWriter(sw)
+	if err := packFile(tw, manifestName, int64(len(manifest)), bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+
+	if err := f(tw); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return sw.Close()
+}
+
+// packFile writes a file with the given name and size, read from r, to the
+// tar archive, readable only by its owner.
+func packFile(tw *tar.Writer, filename string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Size:       size,
+		Uname:      "root",
+		Gname:      "root",
+		Name:       path.Join(".", filename),
+		Mode:       0400,
+		ModTime:    time.Now(),
+		AccessTime: time.Now(),
+		ChangeTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(tw, r)
 	return err
 }
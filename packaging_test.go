@@ -3,13 +3,16 @@ package sneaker
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func TestPackagingRoundTrip(t *testing.T) {
@@ -72,10 +75,32 @@ func TestPackagingRoundTrip(t *testing.T) {
 		output[hdr.Name] = b
 	}
 
+	var manifest Manifest
+	if err := json.Unmarshal(output[manifestName], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	delete(output, manifestName)
+
 	if !reflect.DeepEqual(input, output) {
 		t.Errorf("Input was %#v, but output was %#v", input, output)
 	}
 
+	expected := []ManifestEntry{
+		{
+			Path:   "example.txt",
+			Size:   11,
+			SHA256: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		},
+	}
+
+	if v, want := manifest.Entries, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Manifest entries were %#v, but expected %#v", v, want)
+	}
+
+	if v, want := manifest.KeyID, "key1"; v != want {
+		t.Errorf("Manifest key ID was %q, but expected %q", v, want)
+	}
+
 	genReq := fakeKMS.GenerateInputs[0]
 	if v, want := *genReq.KeyId, "key1"; v != want {
 		t.Errorf("Key ID was %q, but expected %q", v, want)
@@ -111,3 +136,80 @@ func fromAWS(m map[string]*string) map[string]string {
 	}
 	return res
 }
+
+func TestPackPaths(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets"
+
+	input := map[string][]byte{
+		"small.txt": []byte("hello world"),
+		"large.bin": make([]byte, 3*streamChunkSize+5),
+	}
+
+	for path, data := range input {
+		if err := man.Upload(path, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counting := &getCountingStorage{FileStorage: man.Objects.(*FileStorage), gets: map[string]int{}}
+	man.Objects = counting
+
+	context := map[string]string{
+		"hostname": "example.com",
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := man.PackPaths([]string{"small.txt", "large.bin"}, context, "", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"secrets/small.txt", "secrets/large.bin"} {
+		if n := counting.gets[key]; n != 1 {
+			t.Errorf("%s was read %d times, but expected once", key, n)
+		}
+	}
+
+	r, err := man.Unpack(context, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := map[string][]byte{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output[hdr.Name] = b
+	}
+	delete(output, manifestName)
+
+	if !reflect.DeepEqual(input, output) {
+		t.Errorf("Input was %d entries, but output was %d", len(input), len(output))
+	}
+}
+
+// getCountingStorage counts the GET requests made for each object.
+type getCountingStorage struct {
+	*FileStorage
+	mu   sync.Mutex
+	gets map[string]int
+}
+
+func (s *getCountingStorage) GetObject(req *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	s.gets[aws.StringValue(req.Key)]++
+	s.mu.Unlock()
+	return s.FileStorage.GetObject(req)
+}
@@ -0,0 +1,96 @@
+package sneaker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PathErrors is returned by operations on multiple secrets when some of them
+// fail. It maps the path of each failed secret to its error.
+type PathErrors map[string]error
+
+func (e PathErrors) Error() string {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", path, e[path]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// each calls f for each of the given paths, using up to m.Concurrency
+// goroutines. Every path is processed, even if some fail, and any errors are
+// returned as PathErrors. If ctx is done, no more paths are processed and its
+// error is returned once the calls in progress have returned.
+func (m *Manager) each(ctx context.Context, paths []string, f func(string) error) error {
+	n := m.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	if n > len(paths) {
+		n = len(paths)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = PathErrors{}
+		work = make(chan string)
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				if ctx.Err() != nil {
+					continue // drain the remaining paths
+				}
+
+				if err := f(path); err != nil {
+					mu.Lock()
+					errs[path] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		work <- path
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// serialize returns a function which calls f, but never concurrently, so
+// callers' progress callbacks don't need to be safe for concurrent use.
+func serialize(f func(string)) func(string) {
+	if f == nil {
+		return func(string) {}
+	}
+
+	var mu sync.Mutex
+	return func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		f(s)
+	}
+}
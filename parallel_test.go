@@ -0,0 +1,90 @@
+package sneaker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestConcurrentRotate(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets/"
+	man.Concurrency = 4
+
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := fmt.Sprintf("secret%02d.txt", i)
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	before, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not safe for concurrent use
+	var rotated []string
+	if err := man.Rotate("", func(path string) {
+		rotated = append(rotated, path)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(rotated)
+	if v, want := strings.Join(rotated, ","), strings.Join(paths, ","); v != want {
+		t.Errorf("Rotated %v, but expected %v", v, want)
+	}
+
+	after, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range after {
+		if before[i].ETag == after[i].ETag {
+			t.Errorf("%s was not re-encrypted", after[i].Path)
+		}
+	}
+
+	secrets, err := man.Download(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		if v, want := string(secrets[path]), path; v != want {
+			t.Errorf("%s was %q, but expected %q", path, v, want)
+		}
+	}
+}
+
+func TestConcurrentDownloadErrors(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Concurrency = 3
+
+	if err := man.Upload("one", strings.NewReader("one")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := man.Download([]string{"one", "two", "three"})
+	errs, ok := err.(PathErrors)
+	if !ok {
+		t.Fatalf("Error was %v, but expected PathErrors", err)
+	}
+
+	if v, want := len(errs), 2; v != want {
+		t.Fatalf("Had %d errors, but expected %d", v, want)
+	}
+
+	for _, path := range []string{"two", "three"} {
+		if !IsNotFound(errs[path]) {
+			t.Errorf("Error for %s was %v", path, errs[path])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package sneaker
+
+import (
+	"context"
+	"fmt"
+	fpath "path"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// A RekeyResult describes a secret considered by Rekey.
+type RekeyResult struct {
+	Path string
+
+	// KeyID is the ID of the KMS key the secret was encrypted under before
+	// Rekey was called.
+	KeyID string
+
+	// Changed is whether the secret was re-encrypted, or in a dry run, whether
+	// it would have been.
+	Changed bool
+}
+
+// Rekey re-encrypts the secrets whose paths match the given pattern under the
+// given KMS key and encryption context, so secrets can be migrated to another
+// key. If the key ID is blank, m.KeyId is used, and if the context is nil,
+// m.EncryptionContext is used. Secrets which are already encrypted under the
+// key and context are left alone, so Rekey can be run again after a failure.
+// If dryRun is true, no secrets are re-encrypted, but the results report
+// which would be.
+//
+// The results are sorted by path, and include the key each secret was
+// encrypted under. Secrets are processed like Rotate processes them, and any
+// errors are returned as PathErrors.
+func (m *Manager) Rekey(pattern, keyID string, ctxt map[string]string, dryRun bool) ([]RekeyResult, error) {
+	return m.RekeyContext(context.Background(), pattern, keyID, ctxt, dryRun)
+}
+
+// RekeyContext is like Rekey, but stops if ctx is done.
+func (m *Manager) RekeyContext(ctx context.Context, pattern, keyID string, ctxt map[string]string, dryRun bool) ([]RekeyResult, error) {
+	target := m.keying()
+	if keyID != "" {
+		target.keyID = keyID
+	}
+	if ctxt != nil {
+		target.ctxt = ctxt
+	}
+
+	// secrets' headers contain the ID KMS reports, which may differ from the
+	// key ID or alias given
+	targetKeyID, err := m.Envelope.ResolveKeyContext(ctx, target.keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := m.paths(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		results []RekeyResult
+	)
+	err = m.each(ctx, paths, func(path string) error {
+		s, err := m.stat(ctx, fpath.Join(m.Prefix, path), "")
+		if err != nil {
+			return err
+		}
+
+		current := m.keyingOf(s)
+		if s.keyID == "" {
+			if current.keyID, err = m.keyID(ctx, path, current.ctxt); err != nil {
+				return err
+			}
+		}
+
+		result := RekeyResult{
+			Path:    path,
+			KeyID:   current.keyID,
+			Changed: current.keyID != targetKeyID || !sameContext(current.ctxt, target.ctxt),
+		}
+
+		if result.Changed && !dryRun {
+			r, err := m.open(ctx, path, "", nil)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			if err := m.upload(ctx, path, target, nil, nil, r, &r.etag); err != nil {
+				return err
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+		return nil
+	})
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, err
+}
+
+// keyID returns the ID of the KMS key the given secret is encrypted under.
+// Legacy secrets don't record it, so their data keys are decrypted, with the
+// given encryption context, to find it.
+func (m *Manager) keyID(ctx context.Context, path string, ctxt map[string]string) (string, error) {
+	resp, err := m.getObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(fpath.Join(m.Prefix, path)),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	h, err := ReadHeader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if h.Version > 0 {
+		return h.KeyID, nil
+	}
+
+	key, keyID, err := m.Envelope.decryptKey(ctx, m.context(ctxt, path), h.DataKey)
+	if err != nil {
+		return "", err
+	}
+	zero(key)
+	return keyID, nil
+}
+
+// ResolveKey returns the ID KMS reports for the given key ID or alias (i.e.,
+// its ARN), as recorded in the headers of secrets. It does so by generating a
+// data key with it, so it requires permission to encrypt with the key.
+func (e *Envelope) ResolveKey(keyID string) (string, error) {
+	return e.ResolveKeyContext(context.Background(), keyID)
+}
+
+// ResolveKeyContext is like ResolveKey, but the KMS request is cancelled if ctx
+// is done.
+func (e *Envelope) ResolveKeyContext(ctx context.Context, keyID string) (string, error) {
+	key, err := e.generateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeySpec: aws.String("AES_256"),
+		KeyId:   &keyID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to use key %s: %s", keyID, err)
+	}
+	zero(key.Plaintext)
+	return aws.StringValue(key.KeyId), nil
+}
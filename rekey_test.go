@@ -0,0 +1,199 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRekey(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	keyring := man.Envelope.KMS.(*Keyring)
+	if err := keyring.AddKey("key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"team-a/one", "team-a/two", "team-b/three"} {
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	man.KeyId = "key2"
+	if err := man.Upload("team-a/four", strings.NewReader("team-a/four")); err != nil {
+		t.Fatal(err)
+	}
+	man.KeyId = "key1"
+
+	before, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := man.Rekey("team-a/*", "key2", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RekeyResult{
+		{Path: "team-a/four", KeyID: "key2", Changed: false},
+		{Path: "team-a/one", KeyID: "key1", Changed: true},
+		{Path: "team-a/two", KeyID: "key1", Changed: true},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Results were %#v, but expected %#v", results, expected)
+	}
+
+	after, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		t.Error("Dry run modified secrets")
+	}
+
+	if _, err := man.Rekey("team-a/*", "key2", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = man.Rekey("", "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []RekeyResult{
+		{Path: "team-a/four", KeyID: "key2", Changed: true},
+		{Path: "team-a/one", KeyID: "key2", Changed: true},
+		{Path: "team-a/two", KeyID: "key2", Changed: true},
+		{Path: "team-b/three", KeyID: "key1", Changed: false},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Results were %#v, but expected %#v", results, expected)
+	}
+
+	secrets, err := man.Download([]string{"team-a/one", "team-a/four"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, secret := range secrets {
+		if v, want := string(secret), path; v != want {
+			t.Errorf("%s was %q, but expected %q", path, v, want)
+		}
+	}
+}
+
+func TestRekeyContext(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("secret", strings.NewReader("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctxt := map[string]string{"Team": "a"}
+	results, err := man.Rekey("", "", ctxt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := results, []RekeyResult{{Path: "secret", KeyID: "key1", Changed: true}}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Results were %#v, but expected %#v", v, want)
+	}
+
+	// the default manager can still decrypt it
+	secrets, err := man.Download([]string{"secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(secrets["secret"]), "secret"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+
+	// but it's encrypted with the new context
+	resp, err := man.Objects.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(man.Bucket),
+		Key:    aws.String(path.Join(man.Prefix, "secret")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	ciphertext, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := man.Envelope.Open(man.context(nil, "secret"), ciphertext); err == nil {
+		t.Error("Secret could be decrypted with the old context")
+	}
+
+	if _, err := man.Envelope.Open(man.context(ctxt, "secret"), ciphertext); err != nil {
+		t.Errorf("Secret couldn't be decrypted with the new context: %v", err)
+	}
+
+	// which rotating keeps, and which needn't be changed again
+	if err := man.Rotate("", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = man.Rekey("", "", ctxt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := results, []RekeyResult{{Path: "secret", KeyID: "key1", Changed: false}}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Results were %#v, but expected %#v", v, want)
+	}
+}
+
+func TestRotateKeepsKey(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Envelope.KMS.(*Keyring).AddKey("key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Upload("secret", strings.NewReader("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := man.Rekey("", "key2", nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Rotate("", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.Copy("secret", "copy", false); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := man.Rekey("", "key2", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []RekeyResult{
+		{Path: "copy", KeyID: "key2", Changed: false},
+		{Path: "secret", KeyID: "key2", Changed: false},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Results were %#v, but expected %#v", results, expected)
+	}
+}
@@ -0,0 +1,122 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"text/template"
+)
+
+// A Secret is a secret's path and plaintext, as returned by the secrets
+// function in templates.
+type Secret struct {
+	Path  string
+	Value string
+}
+
+// Render executes the given text/template and writes the output to w. In the
+// template, secret returns the plaintext of the secret with the given path
+// (e.g. {{ secret "db/password" }}), and secrets returns the secrets whose
+// paths match the given pattern, sorted by path (e.g. {{ range secrets
+// "certs/*" }}{{ .Path }}: {{ .Value }}{{ end }}).
+//
+// The template is first executed to find the secrets it uses, which are then
+// downloaded together, up to m.Concurrency at a time. If the template uses
+// secrets which depend on the values of others, it's executed again until it
+// doesn't use any new ones. Nothing is written to w unless every secret it
+// uses was downloaded and the template executed successfully. If any secrets
+// couldn't be downloaded, the error is a PathErrors.
+func (m *Manager) Render(w io.Writer, text string) error {
+	return m.RenderContext(context.Background(), w, text)
+}
+
+// RenderContext is like Render, but stops if ctx is done.
+func (m *Manager) RenderContext(ctx context.Context, w io.Writer, text string) error {
+	var (
+		listed  = map[string][]string{}
+		secrets = map[string][]byte{}
+		failed  = PathErrors{}
+		missing []string
+		wanted  map[string]bool
+		errs    PathErrors
+	)
+
+	// secrets which haven't been downloaded yet are blank, and are
+	// downloaded before the template is executed again
+	value := func(path string) string {
+		if err, ok := failed[path]; ok {
+			errs[path] = err
+			return ""
+		}
+
+		v, ok := secrets[path]
+		if !ok && !wanted[path] {
+			wanted[path] = true
+			missing = append(missing, path)
+		}
+		return string(v)
+	}
+
+	tmpl, err := template.New("template").Funcs(template.FuncMap{
+		"secret": value,
+		"secrets": func(pattern string) ([]Secret, error) {
+			paths, ok := listed[pattern]
+			if !ok {
+				var err error
+				if paths, err = m.paths(ctx, pattern); err != nil {
+					return nil, err
+				}
+				listed[pattern] = paths
+			}
+
+			s := make([]Secret, 0, len(paths))
+			for _, path := range paths {
+				s = append(s, Secret{Path: path, Value: value(path)})
+			}
+			return s, nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	for {
+		missing, wanted, errs = nil, map[string]bool{}, PathErrors{}
+
+		buf := bytes.NewBuffer(nil)
+		err := tmpl.Execute(buf, nil)
+		if len(missing) == 0 {
+			if len(errs) > 0 {
+				return errs
+			}
+
+			if err != nil {
+				return err
+			}
+
+			_, err = w.Write(buf.Bytes())
+			return err
+		}
+
+		// errors, including those downloading secrets, may be caused by the
+		// blank values, so they only count if the secrets are still used once
+		// every other secret has been downloaded
+		if err := m.each(ctx, missing, func(path string) error {
+			buf := bytes.NewBuffer(nil)
+			err := m.DownloadToContext(ctx, path, buf)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[path] = err
+			} else {
+				secrets[path] = buf.Bytes()
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package sneaker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for path, secret := range map[string]string{
+		"db/password":  "hunter2",
+		"certs/a.pem":  "A",
+		"certs/b.pem":  "B",
+		"current":      "db/password",
+		"other/c.pem":  "C",
+		"certs/ca/crt": "CA",
+	} {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	text := `password={{ secret "db/password" }}
+{{ range secrets "certs/*" }}{{ .Path }}={{ .Value }}
+{{ end }}indirect={{ secret (secret "current") }}
+`
+
+	buf := bytes.NewBuffer(nil)
+	if err := man.Render(buf, text); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `password=hunter2
+certs/a.pem=A
+certs/b.pem=B
+indirect=hunter2
+`
+
+	if v, want := buf.String(), expected; v != want {
+		t.Errorf("Output was %q, but expected %q", v, want)
+	}
+}
+
+func TestRenderMissing(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Upload("db/password", strings.NewReader("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := man.Render(buf, `{{ secret "db/password" }} {{ secret "db/user" }}`); err == nil {
+		t.Fatal("Rendered a template with a missing secret")
+	}
+
+	if v := buf.Len(); v != 0 {
+		t.Errorf("Wrote %d bytes, but expected none", v)
+	}
+
+	if err := man.Render(buf, `{{ secret }}`); err == nil {
+		t.Error("Rendered a bad template")
+	}
+}
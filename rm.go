@@ -1,17 +1,19 @@
 package sneaker
 
-import (
-	fpath "path"
+import "context"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-)
-
-// Rm deletes the given secret.
+// Rm deletes the given secret by moving it into the trash, from which it can
+// be restored with Undelete until it's purged with PurgeTrash. The trashed
+// secret is re-encrypted for its path in the trash, along with its original
+// path and the user who deleted it.
 func (m *Manager) Rm(path string) error {
-	_, err := m.Objects.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(m.Bucket),
-		Key:    aws.String(fpath.Join(m.Prefix, path)),
-	})
-	return err
+	return m.RmContext(context.Background(), path)
+}
+
+// RmContext is like Rm, but stops if ctx is done.
+func (m *Manager) RmContext(ctx context.Context, path string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	return m.trash(ctx, path)
 }
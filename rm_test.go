@@ -1,35 +1,115 @@
 package sneaker
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func TestRm(t *testing.T) {
-	fakeS3 := &FakeS3{
-		DeleteOutputs: []s3.DeleteObjectOutput{
-			{},
-			{},
-		},
-	}
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets/"
+	man.User = "alice"
+	fs := man.Objects.(*FileStorage)
 
-	man := Manager{
-		Objects: fakeS3,
-		Bucket:  "bucket",
-		Prefix:  "secrets/",
+	if err := man.Upload("weeble/wobble.txt", strings.NewReader("this is a test")); err != nil {
+		t.Fatal(err)
 	}
 
+	before := time.Now().UTC()
 	if err := man.Rm("weeble/wobble.txt"); err != nil {
 		t.Fatal(err)
 	}
 
-	req := fakeS3.DeleteInputs[0]
-	if v, want := *req.Bucket, "bucket"; v != want {
-		t.Errorf("Bucket was %q, but expected %q", v, want)
+	if _, err := os.Stat(filepath.Join(fs.Root, "bucket", "secrets", "weeble", "wobble.txt")); !os.IsNotExist(err) {
+		t.Errorf("Secret wasn't deleted: %v", err)
+	}
+
+	list, err := fs.ListObjects(&s3.ListObjectsInput{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("secrets/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var objects []string
+	for _, obj := range list.Contents {
+		if *obj.Key != "secrets/"+digestKeyPath {
+			objects = append(objects, *obj.Key)
+		}
+	}
+
+	if v, want := len(objects), 1; v != want {
+		t.Fatalf("Had %d objects, but expected %d", v, want)
+	}
+
+	key := objects[0]
+	if !strings.HasPrefix(key, "secrets/.trash/") || !strings.HasSuffix(key, "/weeble/wobble.txt") {
+		t.Errorf("Trashed secret was at %q", key)
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("Listed trashed secrets: %v", files)
+	}
+
+	trash, err := man.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(trash), 1; v != want {
+		t.Fatalf("Had %d trashed secrets, but expected %d", v, want)
+	}
+
+	f := trash[0]
+	if v, want := f.Path, "weeble/wobble.txt"; v != want {
+		t.Errorf("Path was %q, but expected %q", v, want)
+	}
+
+	if v, want := f.TrashPath, strings.TrimPrefix(key, "secrets/"); v != want {
+		t.Errorf("TrashPath was %q, but expected %q", v, want)
+	}
+
+	if v, want := f.DeletedBy, "alice"; v != want {
+		t.Errorf("DeletedBy was %q, but expected %q", v, want)
+	}
+
+	if f.DeletedAt.Before(before.Truncate(time.Second)) || f.DeletedAt.After(time.Now()) {
+		t.Errorf("DeletedAt was %v", f.DeletedAt)
+	}
+
+	// the trashed secret is encrypted for its location in the trash
+	if _, err := man.DownloadVersion(f.TrashPath, ""); err == nil {
+		t.Error("Trashed secret could be decrypted with the context of a secret")
+	}
+
+	if _, err := man.open(context.Background(), f.TrashPath, "", trashContext(f.Path, "bob")); err == nil {
+		t.Error("Trashed secret could be decrypted with the wrong user")
+	}
+}
+
+func TestRmMissing(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	if err := man.Rm("nope"); !IsNotFound(err) {
+		t.Errorf("Error was %v, but expected a not found error", err)
 	}
 
-	if v, want := *req.Key, "secrets/weeble/wobble.txt"; v != want {
-		t.Errorf("Key was %q, but expected %q", v, want)
+	if err := man.Rm(".trash/20060102T150405.000000000Z/nope"); err != ErrReservedPath {
+		t.Errorf("Error was %v, but expected %v", err, ErrReservedPath)
 	}
 }
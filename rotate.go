@@ -1,34 +1,87 @@
 package sneaker
 
-import "bytes"
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Result describes an operation on a single secret.
+type Result struct {
+	Path     string
+	Started  time.Time
+	Duration time.Duration
+
+	// Err is the error the operation failed with, if any.
+	Err error
+}
 
 // Rotate downloads all of the secrets whose paths match the given pattern,
-// decrypts them, re-encrypts them with new data keys, and re-uploads them.
+// decrypts them, re-encrypts them with new data keys under the same KMS keys
+// and encryption contexts, and re-uploads them. Up to m.Concurrency secrets are
+// rotated at once, and f, if not nil, is called with the path of each secret as
+// it's rotated. Calls to f are never concurrent. Every secret is rotated, even
+// if some fail, and any errors are returned as PathErrors.
 func (m *Manager) Rotate(pattern string, f func(string)) error {
-	files, err := m.List(pattern)
-	if err != nil {
-		return err
-	}
+	return m.RotateContext(context.Background(), pattern, f)
+}
 
-	paths := make([]string, 0, len(files))
-	for _, file := range files {
-		paths = append(paths, file.Path)
-	}
+// RotateContext is like Rotate, but stops if ctx is done. Secrets which haven't
+// started rotating are left alone, and those being rotated are either uploaded
+// in full or not at all, so a cancelled rotation can simply be run again. If
+// ctx is done, its error is returned.
+func (m *Manager) RotateContext(ctx context.Context, pattern string, f func(string)) error {
+	return m.rotateAll(ctx, pattern, f, nil)
+}
 
-	secrets, err := m.Download(paths)
+// RotateResults is like Rotate, but f is called with the result of each secret
+// once it has been rotated, or has failed to be, rather than before.
+func (m *Manager) RotateResults(pattern string, f func(Result)) error {
+	return m.RotateResultsContext(context.Background(), pattern, f)
+}
+
+// RotateResultsContext is like RotateResults, but stops if ctx is done, like
+// RotateContext. Secrets which are never started have no results.
+func (m *Manager) RotateResultsContext(ctx context.Context, pattern string, f func(Result)) error {
+	return m.rotateAll(ctx, pattern, nil, f)
+}
+
+// rotateAll rotates the secrets matching the given pattern, calling started, if
+// not nil, with each path before it's rotated, and finished, if not nil, with
+// the result afterwards.
+func (m *Manager) rotateAll(ctx context.Context, pattern string, started func(string), finished func(Result)) error {
+	paths, err := m.paths(ctx, pattern)
 	if err != nil {
 		return err
 	}
 
-	for _, path := range paths {
-		if f != nil {
-			f(path)
-		}
+	var mu sync.Mutex
+	progress := serialize(started)
+	return m.each(ctx, paths, func(path string) error {
+		progress(path)
+
+		r := Result{Path: path, Started: time.Now()}
+		r.Err = m.rotate(ctx, path)
+		r.Duration = time.Since(r.Started)
 
-		if err := m.Upload(path, bytes.NewReader(secrets[path])); err != nil {
-			return err
+		if finished != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			finished(r)
 		}
+		return r.Err
+	})
+}
+
+// rotate re-encrypts the given secret under its KMS key and encryption
+// context, streaming the plaintext from the download to the upload. The upload
+// is only made if the whole secret was downloaded and decrypted.
+func (m *Manager) rotate(ctx context.Context, path string) error {
+	r, err := m.open(ctx, path, "", nil)
+	if err != nil {
+		return err
 	}
+	defer r.Close()
 
-	return nil
+	return m.upload(ctx, path, r.keying, nil, nil, r, nil)
 }
@@ -3,6 +3,9 @@ package sneaker
 import (
 	"bytes"
 	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,6 +50,9 @@ func TestRotate(t *testing.T) {
 			{
 				Body: ioutil.NopCloser(bytes.NewReader(oldCiphertext)),
 			},
+			{
+				Body: ioutil.NopCloser(strings.NewReader("encrypted digest key")),
+			},
 		},
 		PutOutputs: []s3.PutObjectOutput{
 			{},
@@ -59,6 +65,10 @@ func TestRotate(t *testing.T) {
 				KeyId:     aws.String("key1"),
 				Plaintext: oldKey(),
 			},
+			{
+				KeyId:     aws.String("key1"),
+				Plaintext: make([]byte, 32),
+			},
 		},
 		GenerateOutputs: []kms.GenerateDataKeyOutput{
 			{
@@ -116,18 +126,18 @@ func TestRotate(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	header := actual[:4]
-	if v := []byte{0x00, 0x00, 0x00, 0x11}; !bytes.Equal(header, v) {
+	header := actual[:16]
+	if v := []byte("SNKR\x01\x02\x00\x04key1\x00\x00\x00\x11"); !bytes.Equal(header, v) {
 		t.Errorf("Header was %x but expected %x", header, v)
 	}
 
-	blob := actual[4 : 17+4]
+	blob := actual[16 : 17+16]
 	if v := []byte("encrypted new key"); !bytes.Equal(blob, v) {
 		t.Errorf("Blob was %x but expected %x", blob, v)
 	}
 
-	ciphertext := actual[17+4:]
-	plaintext, err := decrypt(newKey(), ciphertext, []byte("key1"))
+	chunk := actual[17+16:]
+	plaintext, err := openChunk(newKey(), chunk, 0, true, actual[:17+16])
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,3 +146,34 @@ func TestRotate(t *testing.T) {
 		t.Errorf("Plaintext was %x but expected %x", v, want)
 	}
 }
+
+func TestRotateResults(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"one", "two"} {
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var paths []string
+	if err := man.RotateResults("", func(r Result) {
+		if r.Err != nil {
+			t.Errorf("Rotating %s failed: %s", r.Path, r.Err)
+		}
+
+		if r.Started.IsZero() || r.Duration <= 0 {
+			t.Errorf("Bad timing for %s: %v, %v", r.Path, r.Started, r.Duration)
+		}
+
+		paths = append(paths, r.Path)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(paths)
+	if v, want := paths, []string{"one", "two"}; !reflect.DeepEqual(v, want) {
+		t.Errorf("Results were for %v, but expected %v", v, want)
+	}
+}
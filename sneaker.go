@@ -5,22 +5,31 @@ package sneaker
 
 import (
 	"fmt"
+	"os/user"
 	fpath "path"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-// ObjectStorage is a sub-set of the capabilities of the S3 client.
+// ObjectStorage is a sub-set of the capabilities of the S3 client. When the S3
+// client is used, requests made by the Manager's context-aware methods are
+// cancelled along with their contexts; other implementations have the contexts
+// checked before each request.
 type ObjectStorage interface {
 	ListObjects(*s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
 	DeleteObject(*s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
 	PutObject(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
 	GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	ListObjectVersions(*s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
 }
 
-// KeyManagement is a sub-set of the capabilities of the KMS client.
+// KeyManagement is a sub-set of the capabilities of the KMS client. Like
+// ObjectStorage, requests made with the KMS client are cancelled along with
+// their contexts.
 type KeyManagement interface {
 	GenerateDataKey(*kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error)
 	Decrypt(*kms.DecryptInput) (*kms.DecryptOutput, error)
@@ -30,22 +39,83 @@ type KeyManagement interface {
 type File struct {
 	Path         string
 	LastModified time.Time
-	Size         int
-	ETag         string
+
+	// Size is the size of the secret's plaintext.
+	Size int
+
+	ETag string
+
+	// KeyId is the ID of the KMS key which encrypted the secret's data key,
+	// usually its ARN. It's blank if it can't be determined.
+	KeyId string
+
+	// FormatVersion is the version of the envelope format of the secret. It's
+	// 0 for secrets written by older versions of sneaker.
+	FormatVersion int
+
+	// Digest is the hex-encoded HMAC-SHA256 of the secret's plaintext, keyed
+	// with the digest key, so secrets can be compared without decrypting
+	// them. It's blank for secrets uploaded without one.
+	Digest string
 }
 
 // A Manager allows you to manage files.
 type Manager struct {
-	Objects           ObjectStorage
-	Envelope          Envelope
+	Objects  ObjectStorage
+	Envelope Envelope
+
+	// KeyId and EncryptionContext are the KMS key and encryption context new
+	// secrets are encrypted with. Each secret records its context, and
+	// secrets which are re-encrypted (e.g. by Rotate or Copy) keep their keys
+	// and contexts. Secrets uploaded before contexts were recorded are
+	// assumed to have been encrypted with EncryptionContext.
 	KeyId             string
 	EncryptionContext map[string]string
-	Bucket, Prefix    string
+
+	Bucket, Prefix string
+
+	// Concurrency is the maximum number of secrets which operations on multiple
+	// secrets (e.g. Download and Rotate) will process at once. If it's zero,
+	// secrets are processed one at a time.
+	Concurrency int
+
+	// User identifies who is making changes, and is recorded when secrets are
+	// deleted. If it's blank, the name of the current OS user is used.
+	User string
+
+	// digestCache holds a *digestKeyCache, once the digest key is needed
+	digestCache atomic.Value
+}
+
+// user returns the name of the user making changes.
+func (m *Manager) user() string {
+	if m.User != "" {
+		return m.User
+	}
+
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// A keying is what a secret is encrypted with: a KMS key, and an encryption
+// context, to which the secret's path is added.
+type keying struct {
+	keyID string
+	ctxt  map[string]string
+}
+
+// keying returns what new secrets are encrypted with.
+func (m *Manager) keying() keying {
+	return keying{keyID: m.KeyId, ctxt: m.EncryptionContext}
 }
 
-func (m *Manager) context(path string) map[string]string {
-	ctxt := make(map[string]string, len(m.EncryptionContext)+1)
-	for k, v := range m.EncryptionContext {
+// context returns the encryption context of the secret with the given path:
+// the given context, plus the path.
+func (m *Manager) context(base map[string]string, path string) map[string]string {
+	ctxt := make(map[string]string, len(base)+1)
+	for k, v := range base {
 		ctxt[k] = v
 	}
 	ctxt["Path"] = fmt.Sprintf("s3://%s/%s", m.Bucket, fpath.Join(m.Prefix, path))
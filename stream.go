@@ -0,0 +1,291 @@
+package sneaker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// SealWriter generates a 256-bit data key using KMS and returns a writer which
+// encrypts everything written to it and writes the result to w. The plaintext
+// is split into 64KiB chunks, each of which is encrypted with AES-256-GCM using
+// a nonce made of the chunk's index and a flag marking the final chunk (i.e.,
+// the STREAM construction). This allows secrets of any size to be encrypted and
+// decrypted using a bounded amount of memory, while still detecting reordered,
+// duplicated, or truncated chunks.
+//
+// The returned writer must be closed to write the final chunk. Closing it does
+// not close w.
+func (e *Envelope) SealWriter(keyID string, ctxt map[string]string, w io.Writer) (io.WriteCloser, error) {
+	return e.SealWriterContext(context.Background(), keyID, ctxt, w)
+}
+
+// SealWriterContext is like SealWriter, but the KMS request is cancelled if ctx
+// is done.
+func (e *Envelope) SealWriterContext(ctx context.Context, keyID string, ctxt map[string]string, w io.Writer) (io.WriteCloser, error) {
+	sw, _, err := e.sealWriter(ctx, keyID, ctxt, w)
+	return sw, err
+}
+
+// sealWriter is SealWriterContext, plus the header it wrote.
+func (e *Envelope) sealWriter(ctx context.Context, keyID string, ctxt map[string]string, w io.Writer) (io.WriteCloser, *Header, error) {
+	key, err := e.generateDataKey(ctx, &kms.GenerateDataKeyInput{
+		EncryptionContext: e.context(ctxt),
+		KeySpec:           aws.String("AES_256"),
+		KeyId:             &keyID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := newHeader(SuiteGCMStream, *key.KeyId, key.CiphertextBlob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := newGCM(key.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := w.Write(header.raw); err != nil {
+		return nil, nil, err
+	}
+
+	return &streamWriter{
+		w:    w,
+		gcm:  gcm,
+		data: header.data(),
+		buf:  make([]byte, 0, streamChunkSize),
+	}, header, nil
+}
+
+// OpenReader takes the output of SealWriter (or Seal) and returns a reader of
+// the decrypted plaintext. If any part of the ciphertext or context is
+// modified, the reader will return an error instead of the modified chunk.
+// Because the plaintext is returned as it is decrypted, callers must not treat
+// anything read as authentic until the reader has returned io.EOF. If the
+// ciphertext is malformed, the error will be a *FormatError.
+func (e *Envelope) OpenReader(ctxt map[string]string, r io.Reader) (io.Reader, error) {
+	return e.OpenReaderContext(context.Background(), ctxt, r)
+}
+
+// OpenReaderContext is like OpenReader, but the KMS request is cancelled if ctx
+// is done, as is reading from the returned reader.
+func (e *Envelope) OpenReaderContext(ctx context.Context, ctxt map[string]string, r io.Reader) (io.Reader, error) {
+	pr, _, _, err := e.openReader(ctx, ctxt, r, -1)
+	return pr, err
+}
+
+// openReader is OpenReader, plus the ciphertext's header and the size of the
+// plaintext if the size of the ciphertext is known.
+func (e *Envelope) openReader(ctx context.Context, ctxt map[string]string, r io.Reader, size int64) (io.Reader, *Header, int64, error) {
+	br := bufio.NewReader(&contextReader{ctx: ctx, r: r})
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if h.Version == 0 || h.Suite == SuiteGCM {
+		// these can only be decrypted in one piece
+		payload, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		plaintext, err := e.open(ctx, ctxt, h, payload)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		return bytes.NewReader(plaintext), h, int64(len(plaintext)), nil
+	}
+
+	key, keyID, err := e.decryptKey(ctx, ctxt, h.DataKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if h.KeyID != keyID {
+		zero(key)
+		return nil, nil, 0, &FormatError{fmt.Sprintf("header key ID %q does not match %q", h.KeyID, keyID)}
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if size >= 0 {
+		size = streamPlaintextSize(size - int64(len(h.raw)))
+	}
+
+	return &streamReader{
+		r:    br,
+		gcm:  gcm,
+		data: h.data(),
+		buf:  make([]byte, streamChunkSize+streamOverhead),
+	}, h, size, nil
+}
+
+type streamWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	data    []byte
+	buf     []byte
+	out     []byte
+	counter uint32
+	closed  bool
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errStreamClosed
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// only flush a full chunk once there's more data, so the final chunk is
+		// never empty unless the whole stream is
+		if len(s.buf) == streamChunkSize {
+			if err := s.flush(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(s.buf[len(s.buf):streamChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return errStreamClosed
+	}
+	s.closed = true
+
+	defer zero(s.buf[:cap(s.buf)])
+	return s.flush(true)
+}
+
+func (s *streamWriter) flush(final bool) error {
+	if s.counter == streamMaxChunks && !final {
+		return errStreamTooLong
+	}
+
+	s.out = s.gcm.Seal(s.out[:0], streamNonce(s.counter, final), s.buf, s.data)
+	s.buf = s.buf[:0]
+	s.counter++
+
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+type streamReader struct {
+	r         *bufio.Reader
+	gcm       cipher.AEAD
+	data      []byte
+	buf       []byte
+	plaintext []byte
+	counter   uint32
+	done      bool
+	err       error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plaintext) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		s.err = s.next()
+	}
+
+	n := copy(p, s.plaintext)
+	s.plaintext = s.plaintext[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	final := false
+	n, err := io.ReadFull(s.r, s.buf)
+	switch err {
+	case nil:
+		// a full chunk is the final chunk if nothing follows it
+		if _, err := s.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		final = true
+	default:
+		return err
+	}
+
+	if n < streamOverhead {
+		return errTruncated
+	}
+
+	if s.counter == streamMaxChunks && !final {
+		return errStreamTooLong
+	}
+
+	plaintext, err := s.gcm.Open(s.buf[:0], streamNonce(s.counter, final), s.buf[:n], s.data)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt chunk %d: %s", s.counter, err)
+	}
+
+	s.counter++
+	s.plaintext = plaintext
+	s.done = final
+	return nil
+}
+
+// streamNonce returns the nonce for the given chunk: seven zero bytes (each
+// data key is only used once, so no random prefix is needed), the chunk's
+// index, and a flag which is set for the final chunk.
+func streamNonce(counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce[7:], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// streamPlaintextSize returns the size of the plaintext encrypted in a stream
+// of chunks of the given size.
+func streamPlaintextSize(n int64) int64 {
+	if n < streamOverhead {
+		return -1
+	}
+	chunks := (n + streamChunkSize + streamOverhead - 1) / (streamChunkSize + streamOverhead)
+	return n - chunks*streamOverhead
+}
+
+var (
+	errStreamClosed  = errors.New("stream already closed")
+	errStreamTooLong = errors.New("stream too long")
+)
+
+const (
+	streamChunkSize = 64 * 1024
+	streamOverhead  = 16 // the GCM tag
+	streamMaxChunks = 1<<32 - 1
+)
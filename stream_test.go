@@ -0,0 +1,133 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	envelope := Envelope{
+		KMS: testKeyring(t),
+	}
+	ctxt := map[string]string{"A": "B"}
+
+	for _, size := range []int{
+		0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1,
+		3 * streamChunkSize, 3*streamChunkSize + 100,
+	} {
+		input := make([]byte, size)
+		if _, err := rand.Read(input); err != nil {
+			t.Fatal(err)
+		}
+
+		ciphertext := seal(t, envelope, ctxt, input)
+
+		r, _, n, err := envelope.openReader(context.Background(), ctxt, bytes.NewReader(ciphertext), int64(len(ciphertext)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, want := n, int64(size); v != want {
+			t.Errorf("Size was %d, but expected %d", v, want)
+		}
+
+		output, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(input, output) {
+			t.Errorf("%d bytes: output did not match input", size)
+		}
+
+		output, err = envelope.Open(ctxt, ciphertext)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(input, output) {
+			t.Errorf("%d bytes: output did not match input", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	envelope := Envelope{
+		KMS: testKeyring(t),
+	}
+	ctxt := map[string]string{"A": "B"}
+
+	input := make([]byte, 3*streamChunkSize+100)
+	ciphertext := seal(t, envelope, ctxt, input)
+	chunk := streamChunkSize + streamOverhead
+	body := len(ciphertext) - 3*chunk - 100 - streamOverhead
+
+	truncated := ciphertext[:body+2*chunk]
+	swapped := append([]byte(nil), ciphertext[:body]...)
+	swapped = append(swapped, ciphertext[body+chunk:body+2*chunk]...)
+	swapped = append(swapped, ciphertext[body:body+chunk]...)
+	swapped = append(swapped, ciphertext[body+2*chunk:]...)
+	flipped := append([]byte(nil), ciphertext...)
+	flipped[len(flipped)-1] ^= 1
+
+	for name, c := range map[string][]byte{
+		"truncated": truncated,
+		"swapped":   swapped,
+		"flipped":   flipped,
+		"header":    ciphertext[:body-1],
+	} {
+		r, err := envelope.OpenReader(ctxt, bytes.NewReader(c))
+		if err != nil {
+			continue
+		}
+
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Errorf("Opened a %s stream", name)
+		}
+	}
+}
+
+func seal(t *testing.T, envelope Envelope, ctxt map[string]string, plaintext []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w, err := envelope.SealWriter("key1", ctxt, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write in odd-sized pieces to exercise chunking
+	for p := plaintext; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openChunk(key, chunk []byte, counter uint32, final bool, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, streamNonce(counter, final), chunk, data)
+}
@@ -0,0 +1,350 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	fpath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/codahale/sneaker/internal/atomicfile"
+)
+
+// SyncOptions control how Push and Pull change their destinations.
+type SyncOptions struct {
+	// Delete is whether to delete secrets (with Push) or files (with Pull)
+	// which don't exist in the source. Otherwise, they're left alone.
+	Delete bool
+
+	// DryRun is whether to only return the changes which would be made.
+	DryRun bool
+}
+
+// A SyncAction is a kind of change made by Push or Pull.
+type SyncAction string
+
+// The changes Push and Pull make.
+const (
+	SyncCreate SyncAction = "create"
+	SyncUpdate SyncAction = "update"
+	SyncDelete SyncAction = "delete"
+)
+
+// A SyncChange is a change which Push or Pull made, or with DryRun, would
+// make, to a secret or a file.
+type SyncChange struct {
+	Action SyncAction
+	Path   string // the secret's path
+	File   string // the local file's name
+}
+
+// Push uploads the files in the given directory and its subdirectories as the
+// secrets under the given prefix (e.g. dir/db/password to app/db/password for
+// the prefix app), returning the changes made, sorted by path.
+//
+// Only new secrets and those whose plaintexts differ from the files are
+// uploaded. Plaintexts are compared by their keyed digests, which are recorded
+// when secrets are uploaded (see Unchanged); secrets uploaded without them are
+// downloaded to compare them. If any secrets can't be compared, nothing is
+// changed. If any can't be uploaded or deleted, the others still are, and the
+// error is a PathErrors.
+func (m *Manager) Push(dir, prefix string, opts SyncOptions) ([]SyncChange, error) {
+	return m.PushContext(context.Background(), dir, prefix, opts)
+}
+
+// PushContext is like Push, but stops if ctx is done.
+func (m *Manager) PushContext(ctx context.Context, dir, prefix string, opts SyncOptions) ([]SyncChange, error) {
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	changes, err := m.diffTree(ctx, dir, prefix, opts.Delete, true)
+	if err != nil || opts.DryRun {
+		return changes, err
+	}
+
+	return m.apply(ctx, changes, func(c SyncChange) error {
+		if c.Action == SyncDelete {
+			return m.RmContext(ctx, c.Path)
+		}
+
+		f, err := os.Open(c.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return m.UploadContext(ctx, c.Path, f)
+	})
+}
+
+// Pull downloads the secrets under the given prefix into the given directory,
+// the reverse of Push. Files are written atomically, readable only by the
+// current user.
+func (m *Manager) Pull(prefix, dir string, opts SyncOptions) ([]SyncChange, error) {
+	return m.PullContext(context.Background(), prefix, dir, opts)
+}
+
+// PullContext is like Pull, but stops if ctx is done.
+func (m *Manager) PullContext(ctx context.Context, prefix, dir string, opts SyncOptions) ([]SyncChange, error) {
+	changes, err := m.diffTree(ctx, dir, prefix, opts.Delete, false)
+	if err != nil || opts.DryRun {
+		return changes, err
+	}
+
+	return m.apply(ctx, changes, func(c SyncChange) error {
+		if c.Action == SyncDelete {
+			return removeFile(dir, c.File)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if err := m.DownloadToContext(ctx, c.Path, buf); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(c.File), 0700); err != nil {
+			return err
+		}
+		return atomicfile.WriteFile(c.File, buf.Bytes(), 0600)
+	})
+}
+
+// diffTree returns the changes which would make the secrets under the given
+// prefix match the files in the given directory (if push is true) or the
+// reverse (if not), sorted by path.
+func (m *Manager) diffTree(ctx context.Context, dir, prefix string, del, push bool) ([]SyncChange, error) {
+	prefix = strings.Trim(prefix, "/")
+
+	files, err := localFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := map[string]bool{}
+	if err := m.walkTree(ctx, prefix, func(f File) error {
+		secrets[strings.TrimPrefix(f.Path, prefix+"/")] = true
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var (
+		changes []SyncChange
+		both    = map[string]SyncChange{}
+		errs    = PathErrors{}
+	)
+
+	for rel, file := range files {
+		c := SyncChange{Path: fpath.Join(prefix, rel), File: file}
+		switch {
+		case reserved(c.Path):
+		case secrets[rel]:
+			both[c.Path] = c
+		case push:
+			c.Action = SyncCreate
+			changes = append(changes, c)
+		case del:
+			c.Action = SyncDelete
+			changes = append(changes, c)
+		}
+	}
+
+	for rel := range secrets {
+		if _, ok := files[rel]; ok || (push && !del) {
+			continue
+		}
+
+		c := SyncChange{Path: fpath.Join(prefix, rel), Action: SyncDelete}
+		if !push {
+			name, err := extractPath(rel)
+			if err != nil {
+				errs[c.Path] = err
+				continue
+			}
+			c.File, c.Action = filepath.Join(dir, name), SyncCreate
+		}
+		changes = append(changes, c)
+	}
+
+	paths := make([]string, 0, len(both))
+	for p := range both {
+		paths = append(paths, p)
+	}
+
+	if len(paths) > 0 {
+		// fetch the digest key before comparing secrets concurrently
+		if _, err := m.newDigest(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	err = m.each(ctx, paths, func(path string) error {
+		c := both[path]
+		local, err := m.fileDigest(ctx, c.File)
+		if err != nil {
+			return err
+		}
+
+		remote, err := m.digest(ctx, c.Path)
+		if err != nil {
+			return err
+		}
+
+		if local != remote {
+			mu.Lock()
+			defer mu.Unlock()
+			c.Action = SyncUpdate
+			changes = append(changes, c)
+		}
+		return nil
+	})
+	if pe, ok := err.(PathErrors); ok {
+		for p, e := range pe {
+			errs[p] = e
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// apply calls f for each of the given changes, up to m.Concurrency at a time,
+// and returns the changes which were made, sorted by path. Deletions are made
+// after everything else, so removing a directory left empty can't race with
+// writing a file to it. If any fail, the error is a PathErrors.
+func (m *Manager) apply(ctx context.Context, changes []SyncChange, f func(SyncChange) error) ([]SyncChange, error) {
+	index := make(map[string]SyncChange, len(changes))
+	var writes, deletes []string
+	for _, c := range changes {
+		index[c.Path] = c
+		if c.Action == SyncDelete {
+			deletes = append(deletes, c.Path)
+		} else {
+			writes = append(writes, c.Path)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		made []SyncChange
+		errs = PathErrors{}
+	)
+
+	for _, paths := range [][]string{writes, deletes} {
+		err := m.each(ctx, paths, func(path string) error {
+			if err := f(index[path]); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			made = append(made, index[path])
+			return nil
+		})
+
+		if pe, ok := err.(PathErrors); ok {
+			for p, e := range pe {
+				errs[p] = e
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(made, func(i, j int) bool {
+		return made[i].Path < made[j].Path
+	})
+
+	if len(errs) > 0 {
+		return made, errs
+	}
+	return made, nil
+}
+
+// digest returns the keyed digest of the given secret's plaintext from its
+// metadata, or for secrets uploaded without one, by downloading it.
+func (m *Manager) digest(ctx context.Context, path string) (string, error) {
+	s, err := m.stat(ctx, fpath.Join(m.Prefix, path), "")
+	if err != nil {
+		return "", err
+	}
+
+	if s.digest != "" {
+		return s.digest, nil
+	}
+
+	h, err := m.newDigest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.DownloadToContext(ctx, path, h); err != nil {
+		return "", err
+	}
+	return sha256Hex(h), nil
+}
+
+// localFiles returns the names of the regular files in the given directory and
+// its subdirectories, by their slash-separated paths relative to it. Files
+// sneaker reserves for itself, such as the temporary files written while
+// files are replaced, are skipped. If the directory doesn't exist, there are
+// none.
+func localFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), fsReserved) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		files[filepath.ToSlash(rel)] = name
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	return files, err
+}
+
+// fileDigest returns the keyed digest of the named file's contents.
+func (m *Manager) fileDigest(ctx context.Context, name string) (string, error) {
+	h, err := m.newDigest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return sha256Hex(h), nil
+}
@@ -0,0 +1,196 @@
+package sneaker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestPush(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	dir, cleanupDir := testDir(t)
+	defer cleanupDir()
+
+	writeFiles(t, dir, map[string]string{
+		"api.key":     "key",
+		"db/password": "hunter2",
+		"same":        "same",
+	})
+
+	for path, secret := range map[string]string{
+		"app/db/password": "hunter1",
+		"app/same":        "same",
+		"app/old":         "old",
+		"other":           "other",
+	} {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []SyncChange{
+		{Action: SyncCreate, Path: "app/api.key", File: filepath.Join(dir, "api.key")},
+		{Action: SyncUpdate, Path: "app/db/password", File: filepath.Join(dir, "db", "password")},
+		{Action: SyncDelete, Path: "app/old"},
+	}
+
+	changes, err := man.Push(dir, "app/", SyncOptions{Delete: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := changes, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Changes were %+v, but expected %+v", v, want)
+	}
+
+	if v, want := download(t, man, "app/db/password"), "hunter1"; v != want {
+		t.Errorf("Dry run changed app/db/password to %q", v)
+	}
+
+	changes, err = man.Push(dir, "app", SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := changes, expected[:2]; !reflect.DeepEqual(v, want) {
+		t.Errorf("Changes were %+v, but expected %+v", v, want)
+	}
+
+	if v, want := download(t, man, "app/db/password"), "hunter2"; v != want {
+		t.Errorf("app/db/password was %q, but expected %q", v, want)
+	}
+
+	changes, err = man.Push(dir, "app", SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := changes, expected[2:]; !reflect.DeepEqual(v, want) {
+		t.Errorf("Changes were %+v, but expected %+v", v, want)
+	}
+
+	files, err := man.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(files), 4; v != want {
+		t.Errorf("There were %d secrets, but expected %d", v, want)
+	}
+
+	if _, err := man.Push(filepath.Join(dir, "missing"), "app", SyncOptions{Delete: true}); err == nil {
+		t.Error("Pushed a missing directory")
+	}
+}
+
+func TestPull(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	dir, cleanupDir := testDir(t)
+	defer cleanupDir()
+
+	writeFiles(t, dir, map[string]string{
+		"db/password": "hunter1",
+		"same":        "same",
+		"old/file":    "old",
+	})
+
+	for path, secret := range map[string]string{
+		"app/api.key":     "key",
+		"app/db/password": "hunter2",
+		"other":           "other",
+	} {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a secret uploaded without a keyed digest, even with an unkeyed one from
+	// an older version, is downloaded to compare it
+	buf := bytes.NewBuffer(nil)
+	w, err := man.Envelope.SealWriter(man.KeyId, man.context(man.EncryptionContext, "app/same"), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("same")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := man.Objects.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(man.Bucket),
+		Key:    aws.String("app/same"),
+		Body:   bytes.NewReader(buf.Bytes()),
+		Metadata: map[string]*string{
+			"Sneaker-Digest": aws.String(fmt.Sprintf("%x", sha256.Sum256([]byte("same")))),
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := man.Pull("app", dir, SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []SyncChange{
+		{Action: SyncCreate, Path: "app/api.key", File: filepath.Join(dir, "api.key")},
+		{Action: SyncUpdate, Path: "app/db/password", File: filepath.Join(dir, "db", "password")},
+		{Action: SyncDelete, Path: "app/old/file", File: filepath.Join(dir, "old", "file")},
+	}
+
+	if v, want := changes, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Changes were %+v, but expected %+v", v, want)
+	}
+
+	assertFile(t, filepath.Join(dir, "api.key"), "key", 0600)
+	assertFile(t, filepath.Join(dir, "db", "password"), "hunter2", 0600)
+	assertFile(t, filepath.Join(dir, "same"), "same", 0644)
+
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Error("Left an empty directory behind")
+	}
+
+	if changes, err := man.Pull("app", dir, SyncOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	} else if len(changes) != 0 {
+		t.Errorf("Changes were %+v, but expected none", changes)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func download(t *testing.T, man *Manager, path string) string {
+	buf := bytes.NewBuffer(nil)
+	if err := man.DownloadTo(path, buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,237 @@
+package sneaker
+
+import (
+	"context"
+	"fmt"
+	fpath "path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// A TrashedFile is a secret which has been deleted, but not yet purged.
+type TrashedFile struct {
+	// Path is the path of the secret before it was deleted.
+	Path string
+
+	// TrashPath is the path of the secret in the trash.
+	TrashPath string
+
+	DeletedAt time.Time
+	DeletedBy string
+	Size      int
+	ETag      string
+}
+
+// Trash returns the secrets in the trash, oldest first.
+func (m *Manager) Trash() ([]TrashedFile, error) {
+	return m.TrashContext(context.Background())
+}
+
+// TrashContext is like Trash, but stops if ctx is done.
+func (m *Manager) TrashContext(ctx context.Context) ([]TrashedFile, error) {
+	prefix := fpath.Join(m.Prefix, trashDir) + "/"
+
+	var files []TrashedFile
+	if err := m.walk(ctx, prefix, func(obj *s3.Object) error {
+		// trashed secrets are stored at .trash/<time>/<path>
+		rest := (*obj.Key)[len(prefix):]
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			return nil
+		}
+
+		deletedAt, err := time.Parse(trashTime, rest[:i])
+		if err != nil {
+			return nil
+		}
+
+		f := TrashedFile{
+			Path:      rest[i+1:],
+			TrashPath: fpath.Join(trashDir, rest),
+			DeletedAt: deletedAt,
+			ETag:      unquote(*obj.ETag),
+		}
+
+		s, err := m.stat(ctx, *obj.Key, "")
+		if err != nil {
+			return err
+		}
+		f.Size = s.size
+		f.DeletedBy = metadata(s.metadata, metaDeletedBy)
+
+		files = append(files, f)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Undelete restores the most recently deleted secret with the given path from
+// the trash. The secret is re-encrypted with a new data key for its original
+// path, under the same KMS key and encryption context. If a secret with the
+// path already exists, it isn't replaced.
+func (m *Manager) Undelete(path string) error {
+	return m.UndeleteContext(context.Background(), path)
+}
+
+// UndeleteContext is like Undelete, but stops if ctx is done.
+func (m *Manager) UndeleteContext(ctx context.Context, path string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+
+	files, err := m.TrashContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var latest *TrashedFile
+	for i, f := range files {
+		if f.Path == path && (latest == nil || f.DeletedAt.After(latest.DeletedAt)) {
+			latest = &files[i]
+		}
+	}
+
+	if latest == nil {
+		return fmt.Errorf("%s is not in the trash", path)
+	}
+
+	r, err := m.open(ctx, latest.TrashPath, "", trashContext(path, latest.DeletedBy))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := m.upload(ctx, path, r.keying, nil, nil, r, aws.String("")); err != nil {
+		if err == ErrModified {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return err
+	}
+
+	_, err = m.deleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(fpath.Join(m.Prefix, latest.TrashPath)),
+	})
+	return err
+}
+
+// PurgeTrash permanently deletes the secrets which were put in the trash before
+// the given time, returning them. If any can't be deleted, the error is a
+// PathErrors, keyed by their paths in the trash.
+func (m *Manager) PurgeTrash(before time.Time) ([]TrashedFile, error) {
+	return m.PurgeTrashContext(context.Background(), before)
+}
+
+// PurgeTrashContext is like PurgeTrash, but stops if ctx is done.
+func (m *Manager) PurgeTrashContext(ctx context.Context, before time.Time) ([]TrashedFile, error) {
+	files, err := m.TrashContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		purged []TrashedFile
+		paths  []string
+	)
+	for _, f := range files {
+		if f.DeletedAt.Before(before) {
+			purged = append(purged, f)
+			paths = append(paths, f.TrashPath)
+		}
+	}
+
+	return purged, m.each(ctx, paths, func(path string) error {
+		_, err := m.deleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(m.Bucket),
+			Key:    aws.String(fpath.Join(m.Prefix, path)),
+		})
+		return err
+	})
+}
+
+// trash moves the given secret into the trash, re-encrypting it under the same
+// KMS key and encryption context, plus its path in the trash, its original
+// path, and the user deleting it. The secret is only deleted once it's in the
+// trash.
+func (m *Manager) trash(ctx context.Context, path string) error {
+	user := m.user()
+	trashPath := fpath.Join(trashDir, time.Now().UTC().Format(trashTime), path)
+
+	r, err := m.open(ctx, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := m.upload(ctx, trashPath, r.keying, trashContext(path, user), map[string]*string{
+		metaOriginalPath: aws.String(path),
+		metaDeletedBy:    aws.String(user),
+	}, r, nil); err != nil {
+		return err
+	}
+
+	_, err = m.deleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(fpath.Join(m.Prefix, path)),
+	})
+	return err
+}
+
+// trashContext returns the encryption context a secret in the trash has, in
+// addition to its own context and path in the trash.
+func trashContext(path, user string) map[string]string {
+	return map[string]string{
+		"OriginalPath": path,
+		"DeletedBy":    user,
+	}
+}
+
+// checkPath returns ErrInvalidPath if the given path isn't clean, or
+// ErrReservedPath if it's used internally by sneaker. Paths are joined with
+// the prefix, which cleans them, so unclean paths (e.g. x/../.trash/y) could
+// otherwise escape the prefix or reach reserved paths.
+func checkPath(path string) error {
+	if path == "" || strings.HasPrefix(path, "/") || fpath.Clean(path) != path {
+		return ErrInvalidPath
+	}
+
+	for _, s := range strings.Split(path, "/") {
+		if s == "." || s == ".." {
+			return ErrInvalidPath
+		}
+	}
+
+	if reserved(path) {
+		return ErrReservedPath
+	}
+	return nil
+}
+
+// reserved returns whether the given path is used internally by sneaker, and
+// therefore isn't a secret.
+func reserved(path string) bool {
+	path = strings.TrimPrefix(path, "/")
+	for _, dir := range []string{trashDir, metaDir} {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	trashDir  = ".trash"
+	trashTime = "20060102T150405.000000000Z"
+
+	// metaDir is where sneaker stores what it needs besides secrets, such as
+	// the digest key
+	metaDir = ".sneaker"
+
+	metaOriginalPath = "Sneaker-Original-Path"
+	metaDeletedBy    = "Sneaker-Deleted-By"
+)
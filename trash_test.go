@@ -0,0 +1,97 @@
+package sneaker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndelete(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.User = "alice"
+
+	for _, s := range []string{"first", "second"} {
+		if err := man.Upload("secret", strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := man.Rm("secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := man.Undelete("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the most recently deleted secret is restored
+	secrets, err := man.Download([]string{"secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(secrets["secret"]), "second"; v != want {
+		t.Errorf("Secret was %q, but expected %q", v, want)
+	}
+
+	trash, err := man.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(trash), 1; v != want {
+		t.Fatalf("Had %d trashed secrets, but expected %d", v, want)
+	}
+
+	// existing secrets aren't replaced
+	if err := man.Undelete("secret"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Error was %v, but expected it to already exist", err)
+	}
+
+	if err := man.Undelete("other"); err == nil || !strings.Contains(err.Error(), "not in the trash") {
+		t.Errorf("Error was %v, but expected it to not be in the trash", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	for _, path := range []string{"one", "two"} {
+		if err := man.Upload(path, strings.NewReader(path)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := man.Rm(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := man.PurgeTrash(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(purged) != 0 {
+		t.Errorf("Purged %v, but expected nothing", purged)
+	}
+
+	purged, err = man.PurgeTrash(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := len(purged), 2; v != want {
+		t.Errorf("Purged %d secrets, but expected %d", v, want)
+	}
+
+	trash, err := man.Trash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trash) != 0 {
+		t.Errorf("Trash still had %v", trash)
+	}
+}
@@ -1,23 +1,19 @@
 package sneaker
 
 import (
-	"bytes"
+	"context"
 	"io"
-	"io/ioutil"
 )
 
 // Unpack decrypts the secrets using KMS and the given context, returning an
-// io.Reader containing a TAR file with all the secrets.
+// io.Reader containing a TAR file with all the secrets. The TAR file is
+// decrypted as it is read, so the reader will return an error if the packed
+// secrets have been modified.
 func (m *Manager) Unpack(ctxt map[string]string, r io.Reader) (io.Reader, error) {
-	ciphertext, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
-
-	plaintext, err := m.Envelope.Open(ctxt, ciphertext)
-	if err != nil {
-		return nil, err
-	}
+	return m.UnpackContext(context.Background(), ctxt, r)
+}
 
-	return bytes.NewReader(plaintext), nil
+// UnpackContext is like Unpack, but the returned reader stops if ctx is done.
+func (m *Manager) UnpackContext(ctx context.Context, ctxt map[string]string, r io.Reader) (io.Reader, error) {
+	return m.Envelope.OpenReaderContext(ctx, ctxt, r)
 }
@@ -2,40 +2,316 @@ package sneaker
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"os"
 	fpath "path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+var (
+	// ErrModified is returned by UploadIfMatch when the secret has been
+	// modified.
+	ErrModified = errors.New("secret has been modified")
+
+	// ErrExists is returned by Copy and Move when a secret already exists at
+	// the destination.
+	ErrExists = errors.New("secret already exists")
+
+	// ErrReservedPath is returned when uploading a secret to a path which
+	// sneaker uses internally, such as the trash.
+	ErrReservedPath = errors.New("reserved path")
+
+	// ErrInvalidPath is returned when uploading a secret to a path which isn't
+	// clean, such as one which is absolute or has . or .. elements.
+	ErrInvalidPath = errors.New("invalid path")
+)
+
 // Upload encrypts the given secret with a KMS data key and uploads it to S3.
+// The secret is encrypted as it is read and the ciphertext is staged in a
+// temporary file, so secrets of any size can be uploaded in bounded memory.
+//
+// A keyed digest of the plaintext is recorded with the secret, so it can be
+// compared with Unchanged. The digest key is stored with the secrets and
+// encrypted with KMS, and is created by the first upload. Fetching it takes
+// permission to get it from S3 and to decrypt it with KMS; if it can't be
+// fetched or created, the secret is uploaded without a digest.
 func (m *Manager) Upload(path string, r io.Reader) error {
-	plaintext, err := ioutil.ReadAll(r)
+	return m.UploadContext(context.Background(), path, r)
+}
+
+// UploadContext is like Upload, but stops if ctx is done.
+func (m *Manager) UploadContext(ctx context.Context, path string, r io.Reader) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	return m.upload(ctx, path, m.keying(), nil, nil, r, nil)
+}
+
+// UploadIfMatch is like Upload, but only replaces the secret if its ETag is
+// still the given ETag, as returned by DownloadWithETag or List. If the ETag is
+// blank, the secret must not exist. Otherwise, ErrModified is returned. The
+// secret keeps its KMS key and encryption context.
+//
+// The ETag is checked after the secret has been encrypted. With FileStorage,
+// it's checked and the secret is replaced atomically. S3 does not support
+// conditional writes, so there it's checked immediately before the secret is
+// uploaded, and a concurrent upload in that window will not be detected.
+func (m *Manager) UploadIfMatch(path string, r io.Reader, etag string) error {
+	return m.UploadIfMatchContext(context.Background(), path, r, etag)
+}
+
+// UploadIfMatchContext is like UploadIfMatch, but stops if ctx is done.
+func (m *Manager) UploadIfMatchContext(ctx context.Context, path string, r io.Reader, etag string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	k := m.keying()
+	if etag != "" {
+		s, err := m.stat(ctx, fpath.Join(m.Prefix, path), "")
+		if err != nil {
+			if IsNotFound(err) {
+				return ErrModified
+			}
+			return err
+		}
+		k = m.keyingOf(s)
+	}
+	return m.upload(ctx, path, k, nil, nil, r, &etag)
+}
+
+// checkETag fails with ErrModified if the object with the given key doesn't
+// have the given ETag, or if the ETag is blank, if the object exists.
+func (m *Manager) checkETag(ctx context.Context, key, etag string) error {
+	resp, err := m.headObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(m.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			if etag == "" {
+				return nil
+			}
+			return ErrModified
+		}
+		return err
+	}
+
+	if unquote(aws.StringValue(resp.ETag)) != unquote(etag) {
+		return ErrModified
+	}
+	return nil
+}
+
+// upload encrypts the plaintext read from r with the given KMS key and
+// encryption context, plus the path and any extra context, and stores it, with
+// the given metadata, at the given path. The context, less the path and extra
+// context, is recorded in the metadata. If ifMatch is not nil, the secret is
+// only replaced if it has that ETag, or if it's blank, doesn't exist, as
+// putObjectIfMatch checks.
+func (m *Manager) upload(ctx context.Context, path string, k keying, extra map[string]string, metadata map[string]*string, r io.Reader, ifMatch *string) error {
+	f, err := ioutil.TempFile("", "sneaker")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	ctxt := m.context(k.ctxt, path)
+	for name, value := range extra {
+		ctxt[name] = value
+	}
+
+	w, err := m.Envelope.SealWriterContext(ctx, k.keyID, ctxt, f)
 	if err != nil {
 		return err
 	}
 
-	ciphertext, err := m.Envelope.Seal(m.KeyId, m.context(path), plaintext)
+	// the digest is best-effort, so uploading only takes permission to
+	// generate data keys and store secrets
+	plaintext := io.Reader(&contextReader{ctx: ctx, r: r})
+	digest, err := m.newDigest(ctx)
+	if err == nil {
+		plaintext = io.TeeReader(plaintext, digest)
+	}
+
+	n, err := io.Copy(w, plaintext)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	// record the KMS key, context, format, plaintext size, and plaintext
+	// digest, so they can be listed and compared without fetching the secret
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	h, err := ReadHeader(f)
 	if err != nil {
 		return err
 	}
 
-	if _, err := m.Objects.PutObject(
-		&s3.PutObjectInput{
-			ContentLength: aws.Int64(int64(len(ciphertext))),
-			ContentType:   aws.String(contentType),
-			Bucket:        aws.String(m.Bucket),
-			Key:           aws.String(fpath.Join(m.Prefix, path)),
-			Body:          bytes.NewReader(ciphertext),
-		},
-	); err != nil {
+	md := map[string]*string{
+		metaKeyID:   aws.String(h.KeyID),
+		metaFormat:  aws.String(strconv.Itoa(h.Version)),
+		metaSize:    aws.String(strconv.FormatInt(n, 10)),
+		metaContext: aws.String(encodeContext(k.ctxt)),
+	}
+	if digest != nil {
+		md[metaDigest] = aws.String(sha256Hex(digest))
+	}
+	for k, v := range metadata {
+		md[k] = v
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req := &s3.PutObjectInput{
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+		Bucket:        aws.String(m.Bucket),
+		Key:           aws.String(fpath.Join(m.Prefix, path)),
+		Metadata:      md,
+		Body:          f,
+	}
+
+	if ifMatch != nil {
+		_, err = m.putObjectIfMatch(ctx, req, *ifMatch)
+	} else {
+		_, err = m.putObject(ctx, req)
+	}
+	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// metadata returns the value of the given metadata key. Keys are matched
+// without regard to case, since S3 doesn't preserve it.
+func metadata(md map[string]*string, key string) string {
+	if v, ok := md[http.CanonicalHeaderKey(key)]; ok {
+		return aws.StringValue(v)
+	}
+
+	for k, v := range md {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// keyingOf returns what the given secret is encrypted with. The KMS key is
+// m.KeyId if it's unknown, and the context m.EncryptionContext if it wasn't
+// recorded.
+func (m *Manager) keyingOf(s *objectStat) keying {
+	k := m.keying()
+	if s.keyID != "" {
+		k.keyID = s.keyID
+	}
+	if s.ctxt != nil {
+		k.ctxt = s.ctxt
+	}
+	return k
+}
+
+// sameContext returns whether the given encryption contexts are the same.
+func sameContext(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeContext encodes the given encryption context as a JSON object, with
+// characters other than ASCII escaped, as S3 metadata must be ASCII.
+func encodeContext(ctxt map[string]string) string {
+	if ctxt == nil {
+		ctxt = map[string]string{}
+	}
+
+	b, err := json.Marshal(ctxt)
+	if err != nil {
+		panic(err) // maps of strings can always be marshalled
+	}
+
+	var buf bytes.Buffer
+	for _, r := range string(b) {
+		if r < utf8.RuneSelf {
+			buf.WriteRune(r)
+		} else if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+			fmt.Fprintf(&buf, "\\u%04x\\u%04x", r1, r2)
+		} else {
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		}
+	}
+	return buf.String()
+}
+
+// decodeContext decodes an encryption context encoded by encodeContext. The
+// context is never nil.
+func decodeContext(s string) (map[string]string, error) {
+	ctxt := map[string]string{}
+	if err := json.Unmarshal([]byte(s), &ctxt); err != nil {
+		return nil, fmt.Errorf("bad encryption context: %s", err)
+	}
+
+	if ctxt == nil {
+		ctxt = map[string]string{}
+	}
+	return ctxt, nil
+}
+
+// IsNotFound returns whether the given error is a response to a request for a
+// secret which doesn't exist.
+func IsNotFound(err error) bool {
+	if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() == 404 {
+		return true
+	}
+
+	if e, ok := err.(awserr.Error); ok {
+		return e.Code() == "NoSuchKey" || e.Code() == "NotFound"
+	}
+	return false
+}
+
 const (
 	contentType = "application/octet-stream"
+
+	// the metadata keys of uploaded secrets
+	metaKeyID   = "Sneaker-Key-Id"
+	metaFormat  = "Sneaker-Format"
+	metaSize    = "Sneaker-Size"
+	metaDigest  = "Sneaker-Hmac"    // the hex-encoded HMAC-SHA256 of the plaintext
+	metaContext = "Sneaker-Context" // the encryption context, less the path
 )
@@ -3,6 +3,7 @@ package sneaker
 import (
 	"bytes"
 	"io/ioutil"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -20,9 +21,20 @@ func TestUpload(t *testing.T) {
 				Plaintext:      make([]byte, 32),
 			},
 		},
+		DecryptOutputs: []kms.DecryptOutput{
+			{
+				KeyId:     aws.String("key1"),
+				Plaintext: make([]byte, 32),
+			},
+		},
 	}
 
 	fakeS3 := &FakeS3{
+		GetOutputs: []s3.GetObjectOutput{
+			{
+				Body: ioutil.NopCloser(strings.NewReader("encrypted digest key")),
+			},
+		},
 		PutOutputs: []s3.PutObjectOutput{
 			{},
 			{},
@@ -44,6 +56,14 @@ func TestUpload(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if v, want := *fakeS3.GetInputs[0].Key, "secrets/.sneaker/digest-key"; v != want {
+		t.Errorf("Digest key was fetched from %q, but expected %q", v, want)
+	}
+
+	if v, want := string(fakeKMS.DecryptInputs[0].CiphertextBlob), "encrypted digest key"; v != want {
+		t.Errorf("Decrypted %q, but expected %q", v, want)
+	}
+
 	putReq := fakeS3.PutInputs[0]
 	if v, want := *putReq.Bucket, "bucket"; v != want {
 		t.Errorf("Bucket was %q, but expected %q", v, want)
@@ -57,6 +77,17 @@ func TestUpload(t *testing.T) {
 		t.Errorf("ContentLength was %d, but expected %d", v, want)
 	}
 
+	expectedMetadata := map[string]*string{
+		"Sneaker-Key-Id":  aws.String("key1"),
+		"Sneaker-Format":  aws.String("1"),
+		"Sneaker-Size":    aws.String("14"),
+		"Sneaker-Context": aws.String(`{"A":"B"}`),
+		"Sneaker-Hmac":    aws.String("68f3a07b5fc446b9885a06c1fb2414cec31e04331d635583528241eaebb8fac4"),
+	}
+	if v, want := putReq.Metadata, expectedMetadata; !reflect.DeepEqual(v, want) {
+		t.Errorf("Metadata was %v, but expected %v", v, want)
+	}
+
 	if v, want := *putReq.ContentType, "application/octet-stream"; v != want {
 		t.Errorf("ContentType was %q, but expected %q", v, want)
 	}
@@ -66,18 +97,18 @@ func TestUpload(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	header := actual[:4]
-	if v := []byte{0x00, 0x00, 0x00, 0x0d}; !bytes.Equal(header, v) {
+	header := actual[:16]
+	if v := []byte("SNKR\x01\x02\x00\x04key1\x00\x00\x00\x0d"); !bytes.Equal(header, v) {
 		t.Errorf("Header was %x but expected %x", header, v)
 	}
 
-	blob := actual[4 : 13+4]
+	blob := actual[16 : 13+16]
 	if v := []byte("encrypted key"); !bytes.Equal(blob, v) {
 		t.Errorf("Blob was %x but expected %x", blob, v)
 	}
 
-	ciphertext := actual[13+4:]
-	plaintext, err := decrypt(make([]byte, 32), ciphertext, []byte("key1"))
+	chunk := actual[13+16:]
+	plaintext, err := openChunk(make([]byte, 32), chunk, 0, true, actual[:13+16])
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,3 +117,52 @@ func TestUpload(t *testing.T) {
 		t.Errorf("Plaintext was %x but expected %x", v, want)
 	}
 }
+
+func TestUploadIfMatch(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+	man.Prefix = "secrets"
+
+	if err := man.UploadIfMatch("weeble.txt", strings.NewReader("one"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := man.UploadIfMatch("weeble.txt", strings.NewReader("two"), ""); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	plaintext, etag, err := man.DownloadWithETag("weeble.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(plaintext), "one"; v != want {
+		t.Errorf("Plaintext was %q, but expected %q", v, want)
+	}
+
+	if err := man.UploadIfMatch("weeble.txt", strings.NewReader("three"), etag); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ETag is now stale
+	if err := man.UploadIfMatch("weeble.txt", strings.NewReader("four"), etag); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	if err := man.UploadIfMatch("wobble.txt", strings.NewReader("five"), etag); err != ErrModified {
+		t.Errorf("Error was %v, but expected %v", err, ErrModified)
+	}
+
+	actual, err := man.Download([]string{"weeble.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, want := string(actual["weeble.txt"]), "three"; v != want {
+		t.Errorf("Plaintext was %q, but expected %q", v, want)
+	}
+
+	if _, _, err := man.DownloadWithETag("wobble.txt"); !IsNotFound(err) {
+		t.Errorf("Error was %v, but expected it to be not found", err)
+	}
+}
@@ -0,0 +1,269 @@
+package sneaker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codahale/sneaker/internal/atomicfile"
+)
+
+// DefaultWatchInterval is how often a Watcher checks for changes by default.
+const DefaultWatchInterval = 30 * time.Second
+
+// watchState is the name of the file in a Watcher's directory which records
+// the ETags of the secrets it last wrote.
+const watchState = fsReserved + "watch.json"
+
+// A Watcher keeps a directory in sync with the secrets matching a pattern.
+// Each secret is written to the file with its path in the directory (e.g.
+// db/password to dir/db/password), readable only by the current user.
+//
+// The ETags of the secrets it writes are recorded in a file in the directory,
+// so only new and changed secrets are downloaded, even across restarts, and
+// files are only removed if they were written for secrets which have since
+// been deleted. Other files in the directory are left alone.
+type Watcher struct {
+	// Manager is where secrets are fetched from.
+	Manager *Manager
+
+	// Pattern is the pattern of secrets to write, in the form used by List.
+	Pattern string
+
+	// Dir is the directory to write secrets to.
+	Dir string
+
+	// Interval is how often Watch checks for changes. If zero,
+	// DefaultWatchInterval is used.
+	Interval time.Duration
+
+	etags map[string]string // the ETags of the written secrets, by path
+}
+
+// WatchChanges are the changes a Watcher made to its directory.
+type WatchChanges struct {
+	// Written are the paths of the secrets which were new or changed.
+	Written []string
+
+	// Removed are the paths of the secrets which were deleted.
+	Removed []string
+}
+
+// Changed returns whether anything was written or removed.
+func (c *WatchChanges) Changed() bool {
+	return len(c.Written) > 0 || len(c.Removed) > 0
+}
+
+// Sync lists the secrets matching the pattern, downloads the ones whose ETags
+// have changed since they were last written, writes the ones whose plaintexts
+// have changed, and removes the ones which have been deleted. Each file is
+// written atomically. If some secrets can't be downloaded or written, the
+// others still are, and the error is a PathErrors.
+func (w *Watcher) Sync() (*WatchChanges, error) {
+	return w.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but stops if ctx is done.
+func (w *Watcher) SyncContext(ctx context.Context) (*WatchChanges, error) {
+	if w.etags == nil {
+		etags, err := w.load()
+		if err != nil {
+			return nil, err
+		}
+		w.etags = etags
+	}
+
+	// the listing has the secrets' ETags, so only changed ones are fetched
+	listed := map[string]bool{}
+	var stale []string
+	if err := w.Manager.walkFiles(ctx, w.Pattern, func(f File) error {
+		listed[f.Path] = true
+		if w.etags[f.Path] != f.ETag || !w.exists(f.Path) {
+			stale = append(stale, f.Path)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		changes = &WatchChanges{}
+		dirty   bool
+	)
+
+	err := w.Manager.each(ctx, stale, func(path string) error {
+		value, etag, err := w.Manager.DownloadWithETagContext(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		written, err := w.write(path, value)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		w.etags[path], dirty = etag, true
+		if written {
+			changes.Written = append(changes.Written, path)
+		}
+		return nil
+	})
+	if _, ok := err.(PathErrors); err != nil && !ok {
+		return nil, err
+	}
+
+	errs, _ := err.(PathErrors)
+	for path := range w.etags {
+		if listed[path] {
+			continue
+		}
+
+		if err := w.remove(path); err != nil {
+			if errs == nil {
+				errs = PathErrors{}
+			}
+			errs[path] = err
+			continue
+		}
+
+		delete(w.etags, path)
+		dirty = true
+		changes.Removed = append(changes.Removed, path)
+	}
+
+	if dirty {
+		if err := w.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(changes.Written)
+	sort.Strings(changes.Removed)
+
+	if len(errs) > 0 {
+		return changes, errs
+	}
+	return changes, nil
+}
+
+// Watch calls Sync every Interval until ctx is done, when it returns nil. After
+// each Sync which changed the directory or failed, it calls f with the
+// changes and error. Failed syncs are retried at the next interval.
+func (w *Watcher) Watch(ctx context.Context, f func(*WatchChanges, error)) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = DefaultWatchInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		changes, err := w.SyncContext(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil || changes.Changed() {
+			f(changes, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// file returns the name of the file the given secret is written to.
+func (w *Watcher) file(path string) (string, error) {
+	name, err := extractPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" || name == watchState {
+		return "", errors.New("invalid path")
+	}
+	return filepath.Join(w.Dir, name), nil
+}
+
+// exists returns whether the file for the given secret exists.
+func (w *Watcher) exists(path string) bool {
+	name, err := w.file(path)
+	if err != nil {
+		return false
+	}
+
+	_, err = os.Lstat(name)
+	return err == nil
+}
+
+// write writes the given secret to its file, unless the file already has the
+// same contents, and returns whether it was written.
+func (w *Watcher) write(path string, value []byte) (bool, error) {
+	name, err := w.file(path)
+	if err != nil {
+		return false, err
+	}
+
+	if b, err := ioutil.ReadFile(name); err == nil && bytes.Equal(b, value) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return false, err
+	}
+	return true, atomicfile.WriteFile(name, value, 0600)
+}
+
+// remove removes the file for the given secret, along with any directories
+// which it leaves empty.
+func (w *Watcher) remove(path string) error {
+	name, err := w.file(path)
+	if err != nil {
+		return err
+	}
+	return removeFile(w.Dir, name)
+}
+
+// load reads the ETags of the secrets written to the directory.
+func (w *Watcher) load() (map[string]string, error) {
+	etags := map[string]string{}
+	b, err := ioutil.ReadFile(filepath.Join(w.Dir, watchState))
+	if os.IsNotExist(err) {
+		return etags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &etags); err != nil {
+		return nil, err
+	}
+	return etags, nil
+}
+
+// save records the ETags of the secrets written to the directory.
+func (w *Watcher) save() error {
+	b, err := json.MarshalIndent(w.etags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(w.Dir, 0700); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(w.Dir, watchState), b, 0600)
+}
@@ -0,0 +1,148 @@
+package sneaker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestWatcherSync(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+	dir := filepath.Join(root, "secrets")
+
+	upload := func(path, secret string) {
+		if err := man.Upload(path, strings.NewReader(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync := func(w *Watcher, expected WatchChanges) {
+		changes, err := w.Sync()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, want := *changes, expected; !reflect.DeepEqual(v, want) {
+			t.Errorf("Changes were %+v, but expected %+v", v, want)
+		}
+	}
+
+	upload("api.key", "key")
+	upload("db/password", "hunter2")
+	upload("other", "other")
+
+	w := &Watcher{Manager: man, Pattern: "api.key,db/*", Dir: dir}
+	sync(w, WatchChanges{Written: []string{"api.key", "db/password"}})
+
+	assertFile(t, filepath.Join(dir, "api.key"), "key", 0600)
+	assertFile(t, filepath.Join(dir, "db", "password"), "hunter2", 0600)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "local"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// polling only lists unchanged secrets
+	counter := &countingStorage{ObjectStorage: man.Objects}
+	man.Objects = counter
+	sync(w, WatchChanges{})
+	man.Objects = counter.ObjectStorage
+
+	if counter.requests != 0 {
+		t.Errorf("Made %d requests for unchanged secrets, but expected none", counter.requests)
+	}
+
+	// a new ETag with the same plaintext isn't a change
+	upload("api.key", "key")
+	upload("db/password", "hunter3")
+	sync(w, WatchChanges{Written: []string{"db/password"}})
+	assertFile(t, filepath.Join(dir, "db", "password"), "hunter3", 0600)
+
+	if err := man.Rm("db/password"); err != nil {
+		t.Fatal(err)
+	}
+
+	sync(w, WatchChanges{Removed: []string{"db/password"}})
+
+	if _, err := os.Stat(filepath.Join(dir, "db")); !os.IsNotExist(err) {
+		t.Error("Left an empty directory behind")
+	}
+
+	assertFile(t, filepath.Join(dir, "local"), "local", 0644)
+
+	// the ETags are remembered across restarts
+	upload("db/password", "hunter4")
+	restarted := &Watcher{Manager: man, Pattern: "api.key,db/*", Dir: dir}
+	sync(restarted, WatchChanges{Written: []string{"db/password"}})
+	sync(restarted, WatchChanges{})
+}
+
+func TestWatch(t *testing.T) {
+	man, cleanup := testFileManager(t)
+	defer cleanup()
+
+	root, cleanupDir := testDir(t)
+	defer cleanupDir()
+
+	if err := man.Upload("api.key", strings.NewReader("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Watcher{Manager: man, Pattern: "*", Dir: root, Interval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls []WatchChanges
+	if err := w.Watch(ctx, func(changes *WatchChanges, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calls = append(calls, *changes)
+		if len(calls) == 1 {
+			if err := man.Upload("api.key", strings.NewReader("new key")); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			cancel()
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []WatchChanges{
+		{Written: []string{"api.key"}},
+		{Written: []string{"api.key"}},
+	}
+
+	if v, want := calls, expected; !reflect.DeepEqual(v, want) {
+		t.Errorf("Changes were %+v, but expected %+v", v, want)
+	}
+}
+
+// countingStorage counts the requests made for individual objects.
+type countingStorage struct {
+	ObjectStorage
+	requests int
+}
+
+func (s *countingStorage) GetObject(req *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	s.requests++
+	return s.ObjectStorage.GetObject(req)
+}
+
+func (s *countingStorage) HeadObject(req *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	s.requests++
+	return s.ObjectStorage.HeadObject(req)
+}